@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// compressionFormat describes how a compression is stored
+type compressionFormat struct {
+	extension       string
+	contentEncoding string
+}
+
+// compressionFormats maps each compression to its key extension and Content-Encoding
+var compressionFormats = map[config.Compression]compressionFormat{
+	config.CompressionNone: {extension: "", contentEncoding: ""},
+	config.CompressionGzip: {extension: ".gz", contentEncoding: "gzip"},
+	config.CompressionZstd: {extension: ".zst", contentEncoding: "zstd"},
+}
+
+// newCompressWriter wraps w so everything written to it is compressed.
+// Closing the returned writer flushes the compressor but does not close w.
+func newCompressWriter(w io.Writer, compression config.Compression, level int) (io.WriteCloser, error) {
+	switch compression {
+	case config.CompressionNone, "":
+		return nopWriteCloser{w}, nil
+	case config.CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case config.CompressionZstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// newDecompressReader wraps r so the backup stored under key is decompressed
+// while reading. The compression is derived from the key extension, so backups
+// can be read regardless of the currently configured compression.
+func newDecompressReader(r io.Reader, key string) (io.ReadCloser, error) {
+	switch compressionFromKey(key) {
+	case config.CompressionGzip:
+		return gzip.NewReader(r)
+	case config.CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// compressionFromKey returns the compression of the backup stored under key
+func compressionFromKey(key string) config.Compression {
+	// Compression is applied before encryption, so its extension comes first
+	key = strings.TrimSuffix(key, encryptedExtension)
+
+	for compression, format := range compressionFormats {
+		if format.extension != "" && strings.HasSuffix(key, format.extension) {
+			return compression
+		}
+	}
+
+	return config.CompressionNone
+}
+
+// nopWriteCloser adds a no-op Close to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
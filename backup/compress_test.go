@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// TestCompressionRoundTrip tests that compressed dumps decompress to the original data
+func TestCompressionRoundTrip(t *testing.T) {
+	dump := strings.Repeat("INSERT INTO t VALUES (1, 'some row');\n", 1000)
+
+	tests := []struct {
+		compression config.Compression
+		level       int
+		key         string
+	}{
+		{config.CompressionNone, 0, "backup/testdb-mysql-20240101-000000.sql"},
+		{config.CompressionGzip, 0, "backup/testdb-mysql-20240101-000000.sql.gz"},
+		{config.CompressionGzip, 9, "backup/testdb-mysql-20240101-000000.sql.gz"},
+		{config.CompressionZstd, 0, "backup/testdb-mysql-20240101-000000.sql.zst"},
+		{config.CompressionZstd, 19, "backup/testdb-mysql-20240101-000000.sql.zst"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.compression), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			writer, err := newCompressWriter(&buf, tt.compression, tt.level)
+			if err != nil {
+				t.Fatalf("Failed to create compressor: %v", err)
+			}
+			if _, err := io.WriteString(writer, dump); err != nil {
+				t.Fatalf("Failed to write dump: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Failed to close compressor: %v", err)
+			}
+
+			if tt.compression != config.CompressionNone && buf.Len() >= len(dump) {
+				t.Errorf("Expected compressed size to be smaller than %d, got %d", len(dump), buf.Len())
+			}
+
+			if compressionFromKey(tt.key) != tt.compression {
+				t.Errorf("Expected compression of %s to be %s, got %s", tt.key, tt.compression, compressionFromKey(tt.key))
+			}
+
+			reader, err := newDecompressReader(&buf, tt.key)
+			if err != nil {
+				t.Fatalf("Failed to create decompressor: %v", err)
+			}
+			defer reader.Close()
+
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed to decompress dump: %v", err)
+			}
+
+			if string(content) != dump {
+				t.Error("Expected decompressed dump to match the original")
+			}
+		})
+	}
+}
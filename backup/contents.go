@@ -0,0 +1,115 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// DumpContents describes which part of the database a dump contains. It is
+// stored in the manifest and the object metadata of partial dumps.
+type DumpContents struct {
+	Mode           string   `json:"mode"`
+	IncludeTables  []string `json:"include_tables,omitempty"`
+	ExcludeTables  []string `json:"exclude_tables,omitempty"`
+	IncludeSchemas []string `json:"include_schemas,omitempty"`
+	ExcludeSchemas []string `json:"exclude_schemas,omitempty"`
+}
+
+// dumpContents describes what the dumps of the configured database contain,
+// or returns nil for complete dumps
+func (s *Service) dumpContents() *DumpContents {
+	mode := s.cfg.DumpMode
+	if mode == "" {
+		mode = config.DumpFull
+	}
+
+	contents := &DumpContents{
+		Mode:           string(mode),
+		IncludeTables:  s.cfg.TableInclude,
+		ExcludeTables:  s.cfg.TableExclude,
+		IncludeSchemas: s.cfg.SchemaInclude,
+		ExcludeSchemas: s.cfg.SchemaExclude,
+	}
+	if !contents.partial() {
+		return nil
+	}
+
+	return contents
+}
+
+// partial reports whether the dump lacks any part of the database
+func (c *DumpContents) partial() bool {
+	return c != nil && (c.Mode != string(config.DumpFull) ||
+		len(c.IncludeTables) > 0 || len(c.ExcludeTables) > 0 ||
+		len(c.IncludeSchemas) > 0 || len(c.ExcludeSchemas) > 0)
+}
+
+// metadata returns the object metadata recording the contents
+func (c *DumpContents) metadata() map[string]string {
+	if c == nil {
+		return nil
+	}
+
+	metadata := map[string]string{"dump-mode": c.Mode}
+	for name, values := range map[string][]string{
+		"include-tables":  c.IncludeTables,
+		"exclude-tables":  c.ExcludeTables,
+		"include-schemas": c.IncludeSchemas,
+		"exclude-schemas": c.ExcludeSchemas,
+	} {
+		if len(values) > 0 {
+			metadata[name] = strings.Join(values, ",")
+		}
+	}
+
+	return metadata
+}
+
+// String describes the contents for log output
+func (c *DumpContents) String() string {
+	parts := []string{c.Mode}
+	for _, filter := range []struct {
+		name   string
+		values []string
+	}{
+		{"tables", c.IncludeTables},
+		{"excluding tables", c.ExcludeTables},
+		{"schemas", c.IncludeSchemas},
+		{"excluding schemas", c.ExcludeSchemas},
+	} {
+		if len(filter.values) > 0 {
+			parts = append(parts, filter.name+" "+strings.Join(filter.values, ", "))
+		}
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// backupContents reads what the backup stored under objName contains from its
+// manifest. It returns nil for complete dumps and backups without a manifest.
+func (s *Service) backupContents(ctx context.Context, objName string) (*DumpContents, error) {
+	backups, err := s.listBackups(ctx, s.backupKeyPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, backup := range backups {
+		if backup.Key != objName {
+			continue
+		}
+
+		manifest, err := s.readManifest(ctx, backup)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest of %s: %w", objName, err)
+		}
+		if manifest == nil {
+			return nil, nil
+		}
+		return manifest.Contents, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,122 @@
+package backup
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// TestDumpContentsArgs tests that filters and dump modes are passed to the dump tools
+func TestDumpContentsArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		expected []string
+	}{
+		{
+			name: "mysql schema only with filtered tables",
+			cfg: config.Config{
+				DBType:       config.MySQL,
+				DBName:       "testdb",
+				DumpMode:     config.DumpSchemaOnly,
+				TableInclude: []string{"users", "orders"},
+				TableExclude: []string{"audit_log"},
+			},
+			expected: []string{"--no-data", "--ignore-table=testdb.audit_log", "testdb", "users", "orders"},
+		},
+		{
+			name: "mysql data only",
+			cfg: config.Config{
+				DBType:   config.MySQL,
+				DBName:   "testdb",
+				DumpMode: config.DumpDataOnly,
+			},
+			expected: []string{"--no-create-info", "testdb"},
+		},
+		{
+			name: "postgres data only with filtered schemas",
+			cfg: config.Config{
+				DBType:        config.PostgreSQL,
+				DBName:        "testdb",
+				DumpMode:      config.DumpDataOnly,
+				TableExclude:  []string{"public.events_*"},
+				SchemaInclude: []string{"public", "billing"},
+				SchemaExclude: []string{"scratch"},
+			},
+			expected: []string{"--no-acl", "--data-only", "--exclude-table=public.events_*", "--schema=public", "--schema=billing", "--exclude-schema=scratch"},
+		},
+		{
+			name: "postgres schema only with included tables",
+			cfg: config.Config{
+				DBType:       config.PostgreSQL,
+				DBName:       "testdb",
+				DumpMode:     config.DumpSchemaOnly,
+				TableInclude: []string{"users"},
+			},
+			expected: []string{"--no-acl", "--schema-only", "--table=users"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &Service{cfg: &tt.cfg}
+
+			var args []string
+			if tt.cfg.DBType == config.MySQL {
+				args = svc.createMySQLDumpCmd(context.Background(), "/tmp/credentials").Args
+			} else {
+				args = svc.createPgDumpCmd(context.Background(), "/tmp/credentials").Args
+			}
+
+			// The filters follow the connection options
+			if len(args) < len(tt.expected) || !slices.Equal(args[len(args)-len(tt.expected):], tt.expected) {
+				t.Errorf("Expected arguments to end with %v, got %v", tt.expected, args)
+			}
+		})
+	}
+}
+
+// TestDumpContents tests how the contents of partial dumps are recorded
+func TestDumpContents(t *testing.T) {
+	// Complete dumps aren't described
+	svc := &Service{cfg: &config.Config{DBType: config.PostgreSQL, DumpMode: config.DumpFull}}
+	if contents := svc.dumpContents(); contents != nil {
+		t.Errorf("Expected no contents for a complete dump, got %v", contents)
+	}
+	if metadata := svc.dumpContents().metadata(); metadata != nil {
+		t.Errorf("Expected no metadata for a complete dump, got %v", metadata)
+	}
+
+	svc = &Service{cfg: &config.Config{
+		DBType:        config.PostgreSQL,
+		DumpMode:      config.DumpFull,
+		TableExclude:  []string{"audit_log", "events"},
+		SchemaInclude: []string{"public"},
+	}}
+
+	contents := svc.dumpContents()
+	if contents == nil {
+		t.Fatal("Expected contents for a filtered dump")
+	}
+
+	metadata := contents.metadata()
+	expected := map[string]string{
+		"dump-mode":       "full",
+		"exclude-tables":  "audit_log,events",
+		"include-schemas": "public",
+	}
+	if len(metadata) != len(expected) {
+		t.Errorf("Expected metadata %v, got %v", expected, metadata)
+	}
+	for key, value := range expected {
+		if metadata[key] != value {
+			t.Errorf("Expected metadata %s to be %q, got %q", key, value, metadata[key])
+		}
+	}
+
+	if got, want := contents.String(), "full; excluding tables audit_log, events; schemas public"; got != want {
+		t.Errorf("Expected description %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// writeCredentials writes the password of the configured user to a temporary
+// file the client tools read it from, keeping it out of the process list.
+// MySQL tools get an option file for --defaults-extra-file, PostgreSQL tools
+// a password file for PGPASSFILE and the MongoDB tools a config file for
+// --config, which also holds the connection URI. The returned cleanup removes
+// the file and must be called once the tools have exited. Other databases
+// get no file.
+func (s *Service) writeCredentials() (string, func(), error) {
+	var pattern, content string
+	switch s.cfg.DBType {
+	case config.MySQL:
+		pattern = "dbdumper-*.cnf"
+		content = "[client]\npassword=" + mysqlOptionValue(s.cfg.DBPassword) + "\n"
+	case config.PostgreSQL:
+		// Match every connection, the file is only used for this one
+		pattern = "dbdumper-*.pgpass"
+		content = "*:*:*:*:" + pgPassValue(s.cfg.DBPassword) + "\n"
+	case config.MongoDB:
+		pattern = "dbdumper-*.yaml"
+		content = s.mongoToolsConfig()
+	default:
+		return "", func() {}, nil
+	}
+
+	return writeSecretFile(pattern, content)
+}
+
+// writeSecretFile writes content to a new temporary file named after pattern.
+// The returned cleanup removes the file.
+func writeSecretFile(pattern, content string) (string, func(), error) {
+	// Temporary files are created readable by the owner only
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create credentials file: %w", err)
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write credentials file: %w", err)
+	}
+
+	return file.Name(), cleanup, nil
+}
+
+// mysqlOptionValue quotes a value for a MySQL option file. The quotes are
+// stripped as a whole, so only the escape sequences need escaping.
+func mysqlOptionValue(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// pgPassValue escapes a field of a PostgreSQL password file
+func pgPassValue(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ":", `\:`)
+	return replacer.Replace(value)
+}
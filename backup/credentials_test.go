@@ -0,0 +1,79 @@
+package backup
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// TestWriteCredentials tests the credentials files passed to the client tools
+func TestWriteCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbType   config.DatabaseType
+		password string
+		expected string
+	}{
+		{
+			name:     "mysql option file",
+			dbType:   config.MySQL,
+			password: `pa"ss\word#1`,
+			expected: "[client]\npassword=\"pa\"ss\\\\word#1\"\n",
+		},
+		{
+			name:     "postgres password file",
+			dbType:   config.PostgreSQL,
+			password: `pa:ss\word`,
+			expected: "*:*:*:*:pa\\:ss\\\\word\n",
+		},
+		{
+			name:     "mongodb config file",
+			dbType:   config.MongoDB,
+			password: `pa"ss\word`,
+			expected: `{"password":"pa\"ss\\word"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMPDIR", t.TempDir())
+			svc := &Service{cfg: &config.Config{DBType: tt.dbType, DBUser: "user", DBPassword: tt.password}}
+
+			path, cleanup, err := svc.writeCredentials()
+			if err != nil {
+				t.Fatalf("Failed to write credentials: %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Failed to stat credentials file: %v", err)
+			}
+			if perm := info.Mode().Perm(); perm != 0o600 {
+				t.Errorf("Expected credentials file permissions 0600, got %o", perm)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read credentials file: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected credentials file %q, got %q", tt.expected, string(data))
+			}
+
+			// The file is gone once the tools are done
+			cleanup()
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Expected credentials file to be removed, got %v", err)
+			}
+		})
+	}
+
+	// Other databases don't need a file
+	svc := &Service{cfg: &config.Config{DBType: config.Redis, DBPassword: "password"}}
+	path, cleanup, err := svc.writeCredentials()
+	if err != nil || path != "" {
+		t.Errorf("Expected no credentials file for redis, got %q, %v", path, err)
+	}
+	cleanup()
+}
@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// systemDatabases are skipped in all databases mode unless DB_INCLUDE_SYSTEM is set
+var systemDatabases = map[config.DatabaseType][]string{
+	config.MySQL:      {"information_schema", "mysql", "performance_schema", "sys"},
+	config.PostgreSQL: {"postgres", "template0", "template1"},
+}
+
+// errNoDatabase is returned when a job backing up all databases is asked for a single backup
+var errNoDatabase = errors.New("the job backs up all databases, select one with --database")
+
+// ForDatabase returns a service for a single database of a job backing up all
+// databases. Backups of the database are stored under the same keys as if it
+// was configured with DB_NAME.
+func (s *Service) ForDatabase(name string) *Service {
+	cfg := *s.cfg
+	cfg.AllDatabases = false
+	cfg.DBInclude = nil
+	cfg.DBExclude = nil
+	cfg.DBName = name
+
+	return &Service{
+		cfg:        &cfg,
+		storage:    s.storage,
+		recipients: s.recipients,
+	}
+}
+
+// performAllBackups backs up every database on the server selected by the
+// include and exclude patterns, each to its own object. It keeps going when a
+// database fails and returns the number of bytes stored.
+func (s *Service) performAllBackups(ctx context.Context) (int64, error) {
+	names, err := s.listDatabases(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var databases []string
+	for _, name := range names {
+		if s.includeDatabase(name) {
+			databases = append(databases, name)
+		}
+	}
+
+	if len(databases) == 0 {
+		return 0, errors.New("no databases matched the include and exclude patterns")
+	}
+
+	fmt.Printf("Backing up %d databases: %s\n", len(databases), strings.Join(databases, ", "))
+
+	var size int64
+	var failed []string
+	for _, name := range databases {
+		n, err := s.ForDatabase(name).performBackup(ctx)
+		size += n
+		if err != nil {
+			fmt.Printf("Error backing up database %s: %v\n", name, err)
+			failed = append(failed, name)
+		}
+
+		// Don't start the remaining databases once cancelled
+		if ctx.Err() != nil {
+			return size, ctx.Err()
+		}
+	}
+
+	if len(failed) > 0 {
+		return size, fmt.Errorf("failed to back up %d of %d databases: %s", len(failed), len(databases), strings.Join(failed, ", "))
+	}
+
+	return size, nil
+}
+
+// includeDatabase reports whether a database is backed up in all databases
+// mode. Exclude patterns take precedence over include patterns.
+func (s *Service) includeDatabase(name string) bool {
+	if !s.cfg.DBIncludeSystem && slices.Contains(systemDatabases[s.cfg.DBType], name) {
+		return false
+	}
+
+	for _, pattern := range s.cfg.DBExclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return false
+		}
+	}
+
+	if len(s.cfg.DBInclude) == 0 {
+		return true
+	}
+
+	for _, pattern := range s.cfg.DBInclude {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listDatabases asks the server for the names of its databases
+func (s *Service) listDatabases(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	credentials, cleanup, err := s.writeCredentials()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var cmd *exec.Cmd
+	switch s.cfg.DBType {
+	case config.MySQL:
+		args := append(s.mysqlConnectionArgs(credentials),
+			"--batch", "--skip-column-names",
+			"--execute", "SHOW DATABASES",
+		)
+		cmd = exec.CommandContext(ctx, "mysql", args...)
+	case config.PostgreSQL:
+		// Connect to the maintenance database, templates can't be dumped
+		cmd = exec.CommandContext(ctx, "psql",
+			"--host", s.cfg.DBHost,
+			"--port", s.cfg.DBPort,
+			"--username", s.cfg.DBUser,
+			"--dbname", "postgres",
+			"--no-align", "--tuples-only",
+			"--command", "SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname",
+		)
+		cmd.Env = s.pgEnv(credentials)
+	default:
+		return nil, fmt.Errorf("listing databases is not supported for %s", s.cfg.DBType)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w (stderr: %s)", err, stderr.String())
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// jobBackups lists the backups of all databases of the job, newest first
+func (s *Service) jobBackups(ctx context.Context) ([]Backup, error) {
+	if !s.cfg.AllDatabases {
+		return s.listBackups(ctx, s.backupKeyPrefix())
+	}
+
+	backups, err := s.listBackups(ctx, s.cfg.BackupPrefix+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip backups of other database types, nested prefixes and databases the job doesn't cover
+	var selected []Backup
+	for _, backup := range backups {
+		if backup.DBType == string(s.cfg.DBType) && path.Dir(backup.Key) == s.cfg.BackupPrefix && s.includeDatabase(backup.DBName) {
+			selected = append(selected, backup)
+		}
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,115 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// TestIncludeDatabase tests filtering databases with include and exclude patterns
+func TestIncludeDatabase(t *testing.T) {
+	cfg := &config.Config{
+		DBType:       config.MySQL,
+		AllDatabases: true,
+		DBInclude:    []string{"shop_*", "crm"},
+		DBExclude:    []string{"*_test"},
+	}
+	svc := &Service{cfg: cfg}
+
+	tests := map[string]bool{
+		"shop_de":   true,
+		"crm":       true,
+		"shop_test": false, // excluded
+		"wiki":      false, // not included
+		"mysql":     false, // system database
+	}
+
+	for name, expected := range tests {
+		if included := svc.includeDatabase(name); included != expected {
+			t.Errorf("Expected includeDatabase(%s) to be %v, got %v", name, expected, included)
+		}
+	}
+
+	// System databases are only backed up when asked for
+	cfg.DBInclude = nil
+	cfg.DBIncludeSystem = true
+	if !svc.includeDatabase("mysql") {
+		t.Error("Expected system database to be included with DBIncludeSystem")
+	}
+}
+
+// TestAllDatabasesRetention tests that retention applies to each database of a job separately
+func TestAllDatabasesRetention(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	keys := []string{
+		"backup/shop-mysql-20240101-000000.sql",
+		"backup/shop-mysql-20240102-000000.sql",
+		"backup/crm-mysql-20240101-000000.sql",
+		"backup/wiki-mysql-20240101-000000.sql", // excluded from the job
+		"backup/shop-postgres-20240101-000000.sql",
+		"backup/nested/shop-mysql-20240101-000000.sql",
+	}
+	for _, key := range keys {
+		if err := backend.Upload(ctx, key, strings.NewReader("dump"), storage.UploadOptions{}); err != nil {
+			t.Fatalf("Failed to upload %s: %v", key, err)
+		}
+	}
+
+	cfg := &config.Config{
+		DBType:       config.MySQL,
+		AllDatabases: true,
+		DBExclude:    []string{"wiki"},
+		KeepLast:     1,
+		BackupPrefix: "backup",
+	}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	backups, err := svc.ListBackups(ctx, false)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	if len(backups) != 3 {
+		t.Fatalf("Expected 3 backups of the job, got %v", backups)
+	}
+
+	if err := svc.cleanupOldBackups(ctx, false); err != nil {
+		t.Fatalf("Failed to cleanup old backups: %v", err)
+	}
+
+	objects, err := backend.List(ctx, "backup/")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+
+	remaining := make(map[string]bool)
+	for _, object := range objects {
+		remaining[object.Key] = true
+	}
+
+	// Only the older shop backup is removed, the newest backup of each database is kept
+	for _, key := range keys {
+		if remaining[key] == (key == keys[0]) {
+			t.Errorf("Unexpected retention for %s: remaining=%v", key, remaining[key])
+		}
+	}
+
+	// Single backups need a database
+	if _, err := svc.findBackup(ctx, ""); err == nil {
+		t.Error("Expected error when selecting a backup without a database")
+	}
+
+	key, err := svc.ForDatabase("crm").findBackup(ctx, "")
+	if err != nil || key != keys[2] {
+		t.Errorf("Expected %s, got %s (%v)", keys[2], key, err)
+	}
+}
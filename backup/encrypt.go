@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// encryptedExtension is appended to the key of encrypted backups
+const encryptedExtension = ".age"
+
+// parseRecipients parses age X25519 public keys
+func parseRecipients(keys []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range keys {
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", key, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// newEncryptWriter wraps w so everything written to it is encrypted to the
+// recipients. Closing the returned writer finishes the age stream but does not close w.
+func newEncryptWriter(w io.Writer, recipients []age.Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nopWriteCloser{w}, nil
+	}
+
+	return age.Encrypt(w, recipients...)
+}
+
+// newDecryptReader wraps r so the backup stored under key is decrypted while
+// reading. Backups without the encrypted extension are passed through unchanged.
+func newDecryptReader(r io.Reader, key, identityFile string) (io.Reader, error) {
+	if !isEncrypted(key) {
+		return r, nil
+	}
+
+	if identityFile == "" {
+		return nil, fmt.Errorf("backup %s is encrypted but AGE_IDENTITY_FILE is not set", key)
+	}
+
+	file, err := os.Open(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age identity file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity file: %w", err)
+	}
+
+	return age.Decrypt(r, identities...)
+}
+
+// isEncrypted reports whether the backup stored under key is encrypted
+func isEncrypted(key string) bool {
+	return strings.HasSuffix(key, encryptedExtension)
+}
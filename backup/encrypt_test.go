@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// TestEncryptedBackupRoundTrip tests that an encrypted and compressed backup opens to the original dump
+func TestEncryptedBackupRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dump := "CREATE TABLE t (id int);\n-- Dump completed\n"
+
+	// Create an identity and write it to an identity file
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	identityFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write identity file: %v", err)
+	}
+
+	recipients, err := parseRecipients([]string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatalf("Failed to parse recipients: %v", err)
+	}
+
+	// Compress and encrypt the dump the same way PerformBackup does
+	var buf bytes.Buffer
+	encryptor, err := newEncryptWriter(&buf, recipients)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	compressor, err := newCompressWriter(encryptor, config.CompressionGzip, 0)
+	if err != nil {
+		t.Fatalf("Failed to create compressor: %v", err)
+	}
+	io.WriteString(compressor, dump)
+	compressor.Close()
+	encryptor.Close()
+
+	if bytes.Contains(buf.Bytes(), []byte("CREATE TABLE")) {
+		t.Fatal("Expected encrypted backup not to contain the plain dump")
+	}
+
+	storageDir := filepath.Join(dir, "storage")
+	os.Mkdir(storageDir, 0o755)
+	backend, err := storage.NewLocalBackend(storageDir)
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	key := "backup/testdb-mysql-20240101-000000.sql.gz.age"
+	if err := backend.Upload(ctx, key, &buf, storage.UploadOptions{}); err != nil {
+		t.Fatalf("Failed to upload backup: %v", err)
+	}
+
+	cfg := &config.Config{AgeIdentityFile: identityFile}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	reader, err := svc.openBackup(ctx, key)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+
+	if string(content) != dump {
+		t.Errorf("Expected decrypted dump to be %q, got %q", dump, content)
+	}
+
+	// Without an identity file the backup can't be opened
+	svc.cfg = &config.Config{}
+	if _, err := svc.openBackup(ctx, key); err == nil {
+		t.Error("Expected error for encrypted backup without identity file, got nil")
+	}
+}
+
+// TestParseRecipients tests that invalid recipients are rejected
+func TestParseRecipients(t *testing.T) {
+	if _, err := parseRecipients([]string{"not-a-key"}); err == nil {
+		t.Error("Expected error for invalid recipient, got nil")
+	}
+
+	recipients, err := parseRecipients(nil)
+	if err != nil || len(recipients) != 0 {
+		t.Errorf("Expected no recipients and no error, got %d and %v", len(recipients), err)
+	}
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timestampFormat is the format of the timestamp in backup keys
+const timestampFormat = "20060102-150405"
+
+// keyPattern matches backup keys of the form prefix/dbname-dbtype-timestamp.ext
+var keyPattern = regexp.MustCompile(`^(.*/)?([^/]+)-([a-z]+)-(\d{8}-\d{6})(\..+)$`)
+
+// Backup describes a stored backup and the objects belonging to it
+type Backup struct {
+	Key          string
+	DBName       string
+	DBType       string
+	Timestamp    time.Time
+	Size         int64
+	LastModified time.Time
+	// Companions are the keys of objects stored alongside the backup, such as its manifest and globals
+	Companions []string
+	// Manifest is only set when requested and the backup has one
+	Manifest *Manifest
+	// KeptBy lists the retention rules protecting the backup, it is due for pruning when empty
+	KeptBy []string
+}
+
+// backupKey holds the parts of a parsed backup key
+type backupKey struct {
+	// base is the key without its extension, shared by the backup and its companions
+	base      string
+	dbName    string
+	dbType    string
+	timestamp time.Time
+	extension string
+}
+
+// parseKey splits a backup key into its parts
+func parseKey(key string) (backupKey, bool) {
+	match := keyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return backupKey{}, false
+	}
+
+	timestamp, err := time.Parse(timestampFormat, match[4])
+	if err != nil {
+		return backupKey{}, false
+	}
+
+	return backupKey{
+		base:      strings.TrimSuffix(key, match[5]),
+		dbName:    match[2],
+		dbType:    match[3],
+		timestamp: timestamp,
+		extension: match[5],
+	}, true
+}
+
+// isCompanion reports whether an object with this extension belongs to a
+// backup rather than being a backup itself
+func isCompanion(extension string) bool {
+	return extension == manifestExtension || strings.HasPrefix(extension, globalsExtension)
+}
+
+// dumpExtension returns the extension of the dump format of the backup stored
+// under key, without compression and encryption, such as ".sql"
+func dumpExtension(key string) string {
+	key = strings.TrimSuffix(key, encryptedExtension)
+	key = strings.TrimSuffix(key, compressionFormats[compressionFromKey(key)].extension)
+
+	parsed, ok := parseKey(key)
+	if !ok {
+		return ""
+	}
+
+	return parsed.extension
+}
+
+// ListBackups lists the backups of the configured database, or of all
+// databases of the job, newest first, along with the retention rules keeping
+// them. With withManifests set, the manifest of each backup is downloaded and
+// parsed.
+func (s *Service) ListBackups(ctx context.Context, withManifests bool) ([]Backup, error) {
+	backups, err := s.jobBackups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, keptBy := range s.applyRetention(backups) {
+		backups[i].KeptBy = keptBy
+	}
+
+	if withManifests {
+		for i := range backups {
+			manifest, err := s.readManifest(ctx, backups[i])
+			if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				continue
+			}
+			backups[i].Manifest = manifest
+		}
+	}
+
+	return backups, nil
+}
+
+// listBackups lists the backups below prefix, newest first, grouping each
+// backup with its companion objects
+func (s *Service) listBackups(ctx context.Context, prefix string) ([]Backup, error) {
+	objects, err := s.storage.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	// Collect the backups first, then attach the companions by base key
+	var backups []Backup
+	var companions []backupKey
+	var companionKeys []string
+	index := make(map[string]int)
+	for _, object := range objects {
+		parsed, ok := parseKey(object.Key)
+		if !ok {
+			continue
+		}
+
+		if isCompanion(parsed.extension) {
+			companions = append(companions, parsed)
+			companionKeys = append(companionKeys, object.Key)
+			continue
+		}
+
+		index[parsed.base] = len(backups)
+		backups = append(backups, Backup{
+			Key:          object.Key,
+			DBName:       parsed.dbName,
+			DBType:       parsed.dbType,
+			Timestamp:    parsed.timestamp,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+	}
+
+	for i, companion := range companions {
+		if j, ok := index[companion.base]; ok {
+			backups[j].Companions = append(backups[j].Companions, companionKeys[i])
+		}
+	}
+
+	// Sort backups by key timestamp (newest first)
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+
+	return backups, nil
+}
+
+// readManifest downloads and parses the manifest of a backup.
+// It returns nil without an error if the backup has no manifest.
+func (s *Service) readManifest(ctx context.Context, backup Backup) (*Manifest, error) {
+	parsed, _ := parseKey(backup.Key)
+	manifestKey := parsed.base + manifestExtension
+
+	found := false
+	for _, companion := range backup.Companions {
+		found = found || companion == manifestKey
+	}
+	if !found {
+		return nil, nil
+	}
+
+	reader, err := s.storage.Download(ctx, manifestKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", manifestKey, err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", manifestKey, err)
+	}
+
+	return &manifest, nil
+}
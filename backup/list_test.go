@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// TestParseKey tests splitting backup keys into their parts
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		base      string
+		dbName    string
+		dbType    string
+		extension string
+	}{
+		{"backup/testdb-mysql-20240102-030405.sql", "backup/testdb-mysql-20240102-030405", "testdb", "mysql", ".sql"},
+		{"a/b/my-app-db-postgres-20240102-030405.sql.gz.age", "a/b/my-app-db-postgres-20240102-030405", "my-app-db", "postgres", ".sql.gz.age"},
+		{"backup/testdb-mysql-20240102-030405.manifest.json", "backup/testdb-mysql-20240102-030405", "testdb", "mysql", ".manifest.json"},
+	}
+
+	for _, tt := range tests {
+		parsed, ok := parseKey(tt.key)
+		if !ok {
+			t.Errorf("Expected %s to be parsed", tt.key)
+			continue
+		}
+
+		if parsed.base != tt.base || parsed.dbName != tt.dbName || parsed.dbType != tt.dbType || parsed.extension != tt.extension {
+			t.Errorf("Unexpected parts for %s: %+v", tt.key, parsed)
+		}
+
+		expected := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		if !parsed.timestamp.Equal(expected) {
+			t.Errorf("Expected timestamp %s, got %s", expected, parsed.timestamp)
+		}
+	}
+
+	for _, key := range []string{"backup/notes.txt", "backup/testdb-mysql-2024.sql"} {
+		if _, ok := parseKey(key); ok {
+			t.Errorf("Expected %s not to be parsed as a backup key", key)
+		}
+	}
+}
+
+// TestListBackups tests grouping backups with their manifests
+func TestListBackups(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	objects := map[string]string{
+		"backup/testdb-mysql-20240101-000000.sql.gz":        "dump",
+		"backup/testdb-mysql-20240101-000000.manifest.json": `{"key": "backup/testdb-mysql-20240101-000000.sql.gz", "sha256": "abc", "size": 42}`,
+		"backup/testdb-mysql-20240102-000000.sql.gz":        "dump",
+		"backup/unrelated.txt":                              "notes",
+	}
+	for key, content := range objects {
+		if err := backend.Upload(ctx, key, strings.NewReader(content), storage.UploadOptions{}); err != nil {
+			t.Fatalf("Failed to upload %s: %v", key, err)
+		}
+	}
+
+	cfg := &config.Config{
+		DBType:       config.MySQL,
+		DBName:       "testdb",
+		KeepLast:     1,
+		BackupPrefix: "backup",
+	}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	backups, err := svc.ListBackups(ctx, true)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %d", len(backups))
+	}
+
+	// Newest backup comes first and has no manifest
+	if backups[0].Key != "backup/testdb-mysql-20240102-000000.sql.gz" || backups[0].Manifest != nil {
+		t.Errorf("Unexpected first backup: %+v", backups[0])
+	}
+
+	older := backups[1]
+	if len(older.Companions) != 1 || older.Companions[0] != "backup/testdb-mysql-20240101-000000.manifest.json" {
+		t.Errorf("Expected manifest to be a companion, got %v", older.Companions)
+	}
+
+	if older.Manifest == nil || older.Manifest.SHA256 != "abc" || older.Manifest.Size != 42 {
+		t.Errorf("Expected parsed manifest, got %+v", older.Manifest)
+	}
+
+	// Only the newest backup is protected by KEEP_LAST=1
+	if len(backups[0].KeptBy) != 1 || backups[0].KeptBy[0] != "KEEP_LAST" || len(older.KeptBy) != 0 {
+		t.Errorf("Unexpected retention: newest kept by %v, older kept by %v", backups[0].KeptBy, older.KeptBy)
+	}
+}
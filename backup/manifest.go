@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// Version is the version of go-dbdumper, set at build time
+var Version = "dev"
+
+// manifestExtension replaces the backup extension for the manifest key
+const manifestExtension = ".manifest.json"
+
+// Manifest describes a backup. It is stored as JSON next to the backup.
+type Manifest struct {
+	Key string `json:"key"`
+	// SHA256 is the checksum of the stored object
+	SHA256 string `json:"sha256"`
+	// Size is the size of the dump before compression and encryption
+	Size int64 `json:"size"`
+	// CompressedSize is the size of the stored object
+	CompressedSize  int64     `json:"compressed_size"`
+	Compression     string    `json:"compression"`
+	Encrypted       bool      `json:"encrypted"`
+	DBType          string    `json:"db_type"`
+	DBName          string    `json:"db_name"`
+	DumpTool        string    `json:"dump_tool"`
+	DumpToolVersion string    `json:"dump_tool_version,omitempty"`
+	ServerVersion   string    `json:"server_version,omitempty"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	DumperVersion   string    `json:"dumper_version"`
+	// Contents describes what a partial dump contains, it is unset for complete dumps
+	Contents *DumpContents `json:"contents,omitempty"`
+	// GlobalsKey is the key of the cluster globals stored with a PostgreSQL backup
+	GlobalsKey string `json:"globals_key,omitempty"`
+}
+
+// writeManifest uploads the manifest of the backup stored under objName
+func (s *Service) writeManifest(ctx context.Context, objName string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	parsed, ok := parseKey(objName)
+	if !ok {
+		return fmt.Errorf("invalid backup key: %s", objName)
+	}
+
+	manifestKey := parsed.base + manifestExtension
+	opts := storage.UploadOptions{ContentType: "application/json"}
+	if err := s.storage.Upload(ctx, manifestKey, bytes.NewReader(data), opts); err != nil {
+		return fmt.Errorf("failed to upload manifest %s: %w", manifestKey, err)
+	}
+
+	return nil
+}
+
+// dumpTool returns the name of the tool that dumps the configured database
+func (s *Service) dumpTool() string {
+	switch s.cfg.DBType {
+	case config.MySQL:
+		return "mysqldump"
+	case config.PostgreSQL:
+		return "pg_dump"
+	case config.MongoDB:
+		return "mongodump"
+	case config.SQLite:
+		return "sqlite3"
+	case config.Redis:
+		return "redis-cli"
+	default:
+		return ""
+	}
+}
+
+// dumpToolVersion returns the version reported by the dump tool, or an empty
+// string if it can't be determined
+func (s *Service) dumpToolVersion(ctx context.Context) string {
+	output, err := exec.CommandContext(ctx, s.dumpTool(), "--version").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// serverVersion asks the database server for its version. It returns an
+// empty string if the server can't be queried.
+func (s *Service) serverVersion(ctx context.Context) string {
+	credentials, cleanup, err := s.writeCredentials()
+	if err != nil {
+		return ""
+	}
+	defer cleanup()
+
+	var cmd *exec.Cmd
+	switch s.cfg.DBType {
+	case config.MySQL:
+		args := append(s.mysqlConnectionArgs(credentials),
+			"--batch", "--skip-column-names",
+			"--execute", "SELECT VERSION()",
+		)
+		cmd = exec.CommandContext(ctx, "mysql", args...)
+	case config.PostgreSQL:
+		cmd = exec.CommandContext(ctx, "psql",
+			"--host", s.cfg.DBHost,
+			"--port", s.cfg.DBPort,
+			"--username", s.cfg.DBUser,
+			"--dbname", s.cfg.DBName,
+			"--no-align", "--tuples-only",
+			"--command", "SHOW server_version",
+		)
+		cmd.Env = s.pgEnv(credentials)
+	case config.MongoDB:
+		script, cleanupScript, err := s.writeMongoshScript("db.version()")
+		if err != nil {
+			return ""
+		}
+		defer cleanupScript()
+		cmd = s.createMongoshCmd(ctx, script)
+	case config.Redis:
+		return s.redisServerVersion(ctx)
+	default:
+		return ""
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
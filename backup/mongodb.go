@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"os/exec"
+)
+
+// mongoConnectionArgs returns the arguments connecting the MongoDB tools to
+// the configured server. The password and connection URI are read from the
+// config file at credentials.
+func (s *Service) mongoConnectionArgs(credentials string) []string {
+	args := []string{"--config=" + credentials}
+	if s.cfg.DBURI == "" {
+		args = append(args, "--host", s.cfg.DBHost, "--port", s.cfg.DBPort)
+	}
+
+	if s.cfg.DBUser != "" {
+		args = append(args, "--username", s.cfg.DBUser)
+	}
+
+	if s.cfg.MongoAuthDatabase != "" {
+		args = append(args, "--authenticationDatabase", s.cfg.MongoAuthDatabase)
+	}
+
+	return args
+}
+
+// mongoToolsConfig returns the config file of the MongoDB tools holding the
+// secret connection settings. JSON is valid YAML, so values are quoted as JSON.
+func (s *Service) mongoToolsConfig() string {
+	settings := struct {
+		Password string `json:"password,omitempty"`
+		URI      string `json:"uri,omitempty"`
+	}{URI: s.cfg.DBURI}
+	if s.cfg.DBUser != "" {
+		settings.Password = s.cfg.DBPassword
+	}
+
+	// Marshalling strings can't fail
+	content, _ := json.Marshal(settings)
+	return string(content) + "\n"
+}
+
+// mongoshURI returns the connection string for mongosh. It has no config file
+// for secrets like the database tools, so the credentials are part of the URI.
+func (s *Service) mongoshURI() (string, error) {
+	uri := s.cfg.DBURI
+	if uri == "" {
+		uri = "mongodb://" + net.JoinHostPort(s.cfg.DBHost, s.cfg.DBPort) + "/"
+	}
+	if s.cfg.DBUser == "" && s.cfg.MongoAuthDatabase == "" {
+		return uri, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		// The parse error contains the URI, which may hold credentials
+		return "", errors.New("invalid MongoDB connection string")
+	}
+
+	if s.cfg.DBUser != "" {
+		u.User = url.UserPassword(s.cfg.DBUser, s.cfg.DBPassword)
+	}
+	if s.cfg.MongoAuthDatabase != "" {
+		query := u.Query()
+		query.Set("authSource", s.cfg.MongoAuthDatabase)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// writeMongoshScript writes a mongosh script connecting to the configured
+// server and printing the result of expr to a temporary file. The connection
+// URI is kept in the file, out of the process list. The returned cleanup
+// removes the file.
+func (s *Service) writeMongoshScript(expr string) (string, func(), error) {
+	uri, err := s.mongoshURI()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Marshalling strings can't fail
+	quoted, _ := json.Marshal(uri)
+	return writeSecretFile("dbdumper-*.js", "db = connect("+string(quoted)+");\nprint("+expr+");\n")
+}
+
+// createMongoshCmd creates a command running the mongosh script at script,
+// which connects to the server itself
+func (s *Service) createMongoshCmd(ctx context.Context, script string) *exec.Cmd {
+	return exec.CommandContext(ctx, "mongosh", "--nodb", "--quiet", "--file", script)
+}
+
+// createMongoDumpCmd creates a command to dump a MongoDB database as an
+// archive written to stdout
+func (s *Service) createMongoDumpCmd(ctx context.Context, credentials string) *exec.Cmd {
+	args := s.mongoConnectionArgs(credentials)
+
+	// Read from secondaries if configured, to keep load off the primary
+	if s.cfg.MongoReadPreference != "" {
+		args = append(args, "--readPreference", s.cfg.MongoReadPreference)
+	}
+
+	args = append(args, "--db", s.cfg.DBName, "--archive")
+
+	return exec.CommandContext(ctx, "mongodump", args...)
+}
+
+// createMongoRestoreCmd creates a command to restore a MongoDB archive read
+// from stdin. Collections in the archive replace the existing ones.
+func (s *Service) createMongoRestoreCmd(ctx context.Context, credentials string) *exec.Cmd {
+	args := append(s.mongoConnectionArgs(credentials),
+		"--nsInclude", s.cfg.DBName+".*",
+		"--drop",
+		"--archive",
+	)
+
+	return exec.CommandContext(ctx, "mongorestore", args...)
+}
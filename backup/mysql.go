@@ -0,0 +1,39 @@
+package backup
+
+// mysqlConnectionArgs returns the arguments connecting the MySQL tools to the
+// configured server, reading the password from the option file at
+// credentials. The option file must be the first argument, so these come
+// before any other.
+func (s *Service) mysqlConnectionArgs(credentials string) []string {
+	args := []string{
+		"--defaults-extra-file=" + credentials,
+		"--host", s.cfg.DBHost,
+		"--port", s.cfg.DBPort,
+		"--user", s.cfg.DBUser,
+	}
+
+	if s.cfg.MySQLSSLMode != "" {
+		args = append(args, "--ssl-mode="+s.cfg.MySQLSSLMode)
+	}
+	if s.cfg.MySQLSSLCA != "" {
+		args = append(args, "--ssl-ca="+s.cfg.MySQLSSLCA)
+	}
+	if s.cfg.MySQLSSLCert != "" {
+		args = append(args, "--ssl-cert="+s.cfg.MySQLSSLCert, "--ssl-key="+s.cfg.MySQLSSLKey)
+	}
+
+	if auth := s.mysqlDefaultAuth(); auth != "" {
+		args = append(args, "--default-auth="+auth)
+	}
+
+	return args
+}
+
+// mysqlDefaultAuth returns the client authentication plugin, or an empty
+// string to let the server decide
+func (s *Service) mysqlDefaultAuth() string {
+	if s.cfg.MySQLDefaultAuth == "none" {
+		return ""
+	}
+	return s.cfg.MySQLDefaultAuth
+}
@@ -0,0 +1,45 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// TestMySQLConnectionArgs tests the TLS and authentication options of the MySQL tools
+func TestMySQLConnectionArgs(t *testing.T) {
+	cfg := &config.Config{
+		DBType:           config.MySQL,
+		DBHost:           "db.example.com",
+		DBPort:           "3306",
+		DBUser:           "user",
+		MySQLSSLMode:     "VERIFY_IDENTITY",
+		MySQLSSLCA:       "/certs/ca.pem",
+		MySQLSSLCert:     "/certs/client.pem",
+		MySQLSSLKey:      "/certs/client-key.pem",
+		MySQLDefaultAuth: "caching_sha2_password",
+	}
+	svc := &Service{cfg: cfg}
+
+	expected := []string{
+		"--defaults-extra-file=/tmp/credentials",
+		"--host", "db.example.com",
+		"--port", "3306",
+		"--user", "user",
+		"--ssl-mode=VERIFY_IDENTITY",
+		"--ssl-ca=/certs/ca.pem",
+		"--ssl-cert=/certs/client.pem",
+		"--ssl-key=/certs/client-key.pem",
+		"--default-auth=caching_sha2_password",
+	}
+	if args := svc.mysqlConnectionArgs("/tmp/credentials"); !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, args)
+	}
+
+	// The server picks the plugin if none is forced
+	cfg.MySQLDefaultAuth = "none"
+	if args := svc.mysqlConnectionArgs("/tmp/credentials"); !reflect.DeepEqual(args, expected[:len(expected)-1]) {
+		t.Errorf("Expected args %v, got %v", expected[:len(expected)-1], args)
+	}
+}
@@ -0,0 +1,446 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// globalsExtension replaces the backup extension for the key of the cluster
+// globals dumped alongside a PostgreSQL backup
+const globalsExtension = ".globals.sql"
+
+// pgDumpFormats maps each pg_dump format to how its dumps are stored
+var pgDumpFormats = map[config.PGDumpFormat]dumpFormat{
+	config.PGDumpPlain:     {extension: ".sql", contentType: "application/sql"},
+	config.PGDumpCustom:    {extension: ".dump", contentType: "application/octet-stream"},
+	config.PGDumpDirectory: {extension: ".dir.tar", contentType: "application/x-tar"},
+	config.PGDumpTar:       {extension: ".tar", contentType: "application/x-tar"},
+}
+
+// pgDumpFormat returns the configured pg_dump format
+func (s *Service) pgDumpFormat() config.PGDumpFormat {
+	if s.cfg.PGDumpFormat == "" {
+		return config.PGDumpPlain
+	}
+
+	return s.cfg.PGDumpFormat
+}
+
+// dumpPgDirectory dumps the configured database in directory format with
+// PG_JOBS parallel jobs and writes the directory to w as a tar stream
+func (s *Service) dumpPgDirectory(ctx context.Context, credentials string, w io.Writer) error {
+	tmpDir, err := os.MkdirTemp("", "dbdumper-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// pg_dump creates the dump directory itself
+	dir := filepath.Join(tmpDir, "dump")
+	cmd := s.createPgDumpCmd(ctx, credentials)
+	cmd.Args = append(cmd.Args, "--jobs", strconv.Itoa(s.pgJobs()), "--file", dir)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		errOutput := stderr.String()
+		fmt.Printf("Database dump error output: %s\n", errOutput)
+		return fmt.Errorf("database dump failed: %w (stderr: %s)", err, errOutput)
+	}
+
+	if err := writeTar(w, dir); err != nil {
+		return fmt.Errorf("failed to pack dump directory: %w", err)
+	}
+
+	return nil
+}
+
+// restorePgArchive restores a custom, tar or directory format dump read from
+// r with pg_restore. Parallel restores need random access to the dump, so the
+// dump is written to a temporary file or directory first.
+func (s *Service) restorePgArchive(ctx context.Context, credentials, objName string, r io.Reader) error {
+	var input string
+	switch dumpExtension(objName) {
+	case pgDumpFormats[config.PGDumpDirectory].extension:
+		tmpDir, err := os.MkdirTemp("", "dbdumper-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if err := extractTar(r, tmpDir); err != nil {
+			return fmt.Errorf("failed to unpack dump directory: %w", err)
+		}
+		input = tmpDir
+	case pgDumpFormats[config.PGDumpCustom].extension:
+		if s.pgJobs() == 1 {
+			break // Stream from stdin
+		}
+
+		file, err := os.CreateTemp("", "dbdumper-*.dump")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := io.Copy(file, r); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write dump: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write dump: %w", err)
+		}
+		input = file.Name()
+	}
+
+	cmd := s.createPgRestoreCmd(ctx, credentials, input)
+	if input == "" {
+		cmd.Stdin = r
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		errOutput := stderr.String()
+		fmt.Printf("Database restore error output: %s\n", errOutput)
+		return fmt.Errorf("database restore failed: %w (stderr: %s)", err, errOutput)
+	}
+
+	return nil
+}
+
+// createPgRestoreCmd creates a command restoring the dump at input into the
+// configured database, or the dump read from stdin if input is empty
+func (s *Service) createPgRestoreCmd(ctx context.Context, credentials, input string) *exec.Cmd {
+	args := []string{
+		"--host", s.cfg.DBHost,
+		"--port", s.cfg.DBPort,
+		"--username", s.cfg.DBUser,
+		"--dbname", s.cfg.DBName,
+		"--no-owner",
+		"--no-acl",
+		"--exit-on-error",
+	}
+
+	// Parallel restores read the dump from a file or directory
+	if input != "" {
+		args = append(args, "--jobs", strconv.Itoa(s.pgJobs()), input)
+	}
+
+	cmd := exec.CommandContext(ctx, "pg_restore", args...)
+	cmd.Env = s.pgEnv(credentials)
+
+	return cmd
+}
+
+// backupGlobals dumps the roles and tablespaces of the cluster with
+// pg_dumpall and stores them as a companion of the backup stored under
+// objName. It returns the key of the companion.
+func (s *Service) backupGlobals(ctx context.Context, objName string) (string, error) {
+	parsed, ok := parseKey(objName)
+	if !ok {
+		return "", fmt.Errorf("invalid backup key: %s", objName)
+	}
+
+	// Globals are small, so they are compressed and encrypted in memory
+	var buf bytes.Buffer
+	encryptor, err := newEncryptWriter(&buf, s.recipients)
+	if err != nil {
+		return "", fmt.Errorf("failed to create encryptor: %w", err)
+	}
+
+	compressor, err := newCompressWriter(encryptor, s.cfg.Compression, s.cfg.CompressionLevel)
+	if err != nil {
+		return "", fmt.Errorf("failed to create compressor: %w", err)
+	}
+
+	credentials, cleanup, err := s.writeCredentials()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	cmd := s.createPgDumpallCmd(ctx, credentials)
+
+	var stderr bytes.Buffer
+	cmd.Stdout = compressor
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		errOutput := stderr.String()
+		fmt.Printf("Database globals dump error output: %s\n", errOutput)
+		return "", fmt.Errorf("database globals dump failed: %w (stderr: %s)", err, errOutput)
+	}
+
+	if err := compressor.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress globals: %w", err)
+	}
+	if err := encryptor.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt globals: %w", err)
+	}
+
+	// Store the globals like the backup itself, with the same base key
+	format := compressionFormats[s.cfg.Compression]
+	globalsKey := parsed.base + globalsExtension + format.extension
+	opts := storage.UploadOptions{
+		ContentType:     "application/sql",
+		ContentEncoding: format.contentEncoding,
+	}
+	if len(s.recipients) > 0 {
+		globalsKey += encryptedExtension
+		opts = storage.UploadOptions{ContentType: "application/octet-stream"}
+	}
+
+	if err := s.storage.Upload(ctx, globalsKey, &buf, opts); err != nil {
+		return "", fmt.Errorf("failed to upload globals %s: %w", globalsKey, err)
+	}
+
+	return globalsKey, nil
+}
+
+// RestoreGlobals loads the cluster globals stored with the backup selected by
+// ref into the server, so roles exist before the backup is restored. The ref
+// is interpreted the same way as for PerformRestore.
+func (s *Service) RestoreGlobals(ctx context.Context, ref string) error {
+	objName, err := s.findBackup(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	backups, err := s.listBackups(ctx, s.backupKeyPrefix())
+	if err != nil {
+		return err
+	}
+
+	var globalsKey string
+	for _, backup := range backups {
+		if backup.Key != objName {
+			continue
+		}
+		for _, companion := range backup.Companions {
+			if parsed, ok := parseKey(companion); ok && strings.HasPrefix(parsed.extension, globalsExtension) {
+				globalsKey = companion
+			}
+		}
+	}
+	if globalsKey == "" {
+		return fmt.Errorf("backup %s has no globals", objName)
+	}
+
+	reader, err := s.openBackup(ctx, globalsKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	credentials, cleanup, err := s.writeCredentials()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := s.createPsqlGlobalsCmd(ctx, credentials)
+
+	var stderr bytes.Buffer
+	cmd.Stdin = reader
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		errOutput := stderr.String()
+		fmt.Printf("Database globals restore error output: %s\n", errOutput)
+		return fmt.Errorf("database globals restore failed: %w (stderr: %s)", err, errOutput)
+	}
+
+	// Roles that already exist are reported but don't stop the restore
+	if stderr.Len() > 0 {
+		fmt.Printf("Database globals restore output: %s\n", stderr.String())
+	}
+
+	fmt.Printf("Restored globals: %s\n", globalsKey)
+	return nil
+}
+
+// createPgDumpallCmd creates a command to dump the roles and tablespaces of
+// the PostgreSQL cluster
+func (s *Service) createPgDumpallCmd(ctx context.Context, credentials string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "pg_dumpall",
+		"--host", s.cfg.DBHost,
+		"--port", s.cfg.DBPort,
+		"--username", s.cfg.DBUser,
+		"--database", s.cfg.DBName,
+		"--globals-only",
+	)
+	cmd.Env = s.pgEnv(credentials)
+
+	return cmd
+}
+
+// createPsqlGlobalsCmd creates a command to load cluster globals. It connects
+// to the maintenance database, since the backed up database may not exist
+// yet, and keeps going when a role already exists.
+func (s *Service) createPsqlGlobalsCmd(ctx context.Context, credentials string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "psql",
+		"--host", s.cfg.DBHost,
+		"--port", s.cfg.DBPort,
+		"--username", s.cfg.DBUser,
+		"--dbname", "postgres",
+		"--quiet",
+	)
+	cmd.Env = s.pgEnv(credentials)
+
+	return cmd
+}
+
+// pgJobs returns the number of parallel pg_dump and pg_restore jobs
+func (s *Service) pgJobs() int {
+	if s.cfg.PGJobs < 1 {
+		return 1
+	}
+
+	return s.cfg.PGJobs
+}
+
+// pgStrippedEnv lists the variables the PostgreSQL tools don't inherit. The
+// libpq connection variables would override the configured connection and
+// the dumper's secrets have no business in the tools' environment.
+var pgStrippedEnv = []string{
+	"PGHOST", "PGHOSTADDR", "PGPORT", "PGDATABASE", "PGUSER", "PGPASSWORD",
+	"PGPASSFILE", "PGSERVICE", "PGSERVICEFILE", "PGOPTIONS", "PGSSLMODE",
+	"PGREQUIRESSL", "PGSSLROOTCERT", "PGSSLCERT", "PGSSLKEY", "PGSSLCRL",
+	"PGSSLPASSWORD", "PGAPPNAME", "PGCONNECT_TIMEOUT", "PGTARGETSESSIONATTRS",
+	"DB_PASSWORD", "DB_URI", "DATABASE_URL", "S3_ACCESS_KEY", "S3_SECRET_KEY",
+}
+
+// pgEnv returns the environment of the PostgreSQL tools. They inherit the
+// dumper's environment without connection variables and secrets, with the
+// password file at credentials and the configured libpq connection settings
+// on top.
+func (s *Service) pgEnv(credentials string) []string {
+	var env []string
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if !slices.Contains(pgStrippedEnv, strings.TrimSuffix(name, "_FILE")) {
+			env = append(env, variable)
+		}
+	}
+	env = append(env, "PGPASSFILE="+credentials)
+
+	for _, setting := range []struct {
+		name  string
+		value string
+	}{
+		{"PGSSLMODE", s.cfg.PGSSLMode},
+		{"PGSSLROOTCERT", s.cfg.PGSSLRootCert},
+		{"PGSSLCERT", s.cfg.PGSSLCert},
+		{"PGSSLKEY", s.cfg.PGSSLKey},
+		{"PGAPPNAME", s.cfg.PGApplicationName},
+	} {
+		if setting.value != "" {
+			env = append(env, setting.name+"="+setting.value)
+		}
+	}
+
+	if s.cfg.PGConnectTimeout > 0 {
+		env = append(env, "PGCONNECT_TIMEOUT="+strconv.Itoa(s.cfg.PGConnectTimeout))
+	}
+
+	return env
+}
+
+// writeTar writes the regular files in dir to w as a tar stream
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// extractTar unpacks the regular files of the tar stream r into dir
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Never write outside of dir
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("invalid file name in archive: %s", header.Name)
+		}
+
+		path := filepath.Join(dir, header.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(file, tr); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// TestTarRoundTrip tests packing a dump directory and unpacking it again
+func TestTarRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"toc.dat":     "table of contents",
+		"3456.dat.gz": "table data",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeTar(&buf, src); err != nil {
+		t.Fatalf("Failed to write tar: %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := extractTar(&buf, dst); err != nil {
+		t.Fatalf("Failed to extract tar: %v", err)
+	}
+
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %s to contain %q, got %q", name, content, data)
+		}
+	}
+}
+
+// TestCreatePgRestoreCmd tests the arguments passed to pg_restore
+func TestCreatePgRestoreCmd(t *testing.T) {
+	cfg := &config.Config{
+		DBType:       config.PostgreSQL,
+		DBHost:       "localhost",
+		DBPort:       "5432",
+		DBName:       "testdb",
+		DBUser:       "user",
+		DBPassword:   "password",
+		PGDumpFormat: config.PGDumpDirectory,
+		PGJobs:       4,
+	}
+	svc := &Service{cfg: cfg}
+
+	cmd := svc.createPgRestoreCmd(context.Background(), "/tmp/credentials", "/tmp/dump")
+
+	expected := []string{
+		"pg_restore",
+		"--host", "localhost",
+		"--port", "5432",
+		"--username", "user",
+		"--dbname", "testdb",
+		"--no-owner",
+		"--no-acl",
+		"--exit-on-error",
+		"--jobs", "4",
+		"/tmp/dump",
+	}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, cmd.Args)
+	}
+
+	// Dumps streamed from stdin are restored by a single job
+	cmd = svc.createPgRestoreCmd(context.Background(), "/tmp/credentials", "")
+	if !reflect.DeepEqual(cmd.Args, expected[:len(expected)-3]) {
+		t.Errorf("Expected args %v, got %v", expected[:len(expected)-3], cmd.Args)
+	}
+}
+
+// TestPgEnv tests the environment of the PostgreSQL tools
+func TestPgEnv(t *testing.T) {
+	t.Setenv("TZ", "Europe/Zurich")
+	t.Setenv("PGPASSWORD", "password")
+	t.Setenv("PGHOST", "other.internal")
+	t.Setenv("DB_PASSWORD_FILE", "/run/secrets/db_password")
+	t.Setenv("S3_SECRET_KEY", "secretkey")
+
+	svc := &Service{cfg: &config.Config{
+		DBType:            config.PostgreSQL,
+		PGSSLMode:         "verify-full",
+		PGSSLRootCert:     "/certs/ca.pem",
+		PGApplicationName: "dbdumper",
+		PGConnectTimeout:  10,
+	}}
+	env := svc.pgEnv("/tmp/credentials")
+
+	// The tools keep the dumper's environment
+	for _, expected := range []string{
+		"TZ=Europe/Zurich",
+		"PGPASSFILE=/tmp/credentials",
+		"PGSSLMODE=verify-full",
+		"PGSSLROOTCERT=/certs/ca.pem",
+		"PGAPPNAME=dbdumper",
+		"PGCONNECT_TIMEOUT=10",
+	} {
+		if !slices.Contains(env, expected) {
+			t.Errorf("Expected environment to contain %s", expected)
+		}
+	}
+
+	// Unset settings are left to libpq, connection variables and secrets
+	// aren't inherited
+	for _, variable := range env {
+		name, _, _ := strings.Cut(variable, "=")
+		switch name {
+		case "PGSSLCERT", "PGSSLKEY", "PGPASSWORD", "PGHOST", "DB_PASSWORD_FILE", "S3_SECRET_KEY":
+			t.Errorf("Expected %s to be unset", variable)
+		}
+	}
+}
+
+// TestDumpExtension tests finding the dump format of backup keys
+func TestDumpExtension(t *testing.T) {
+	tests := map[string]string{
+		"backup/testdb-postgres-20240101-000000.sql":            ".sql",
+		"backup/testdb-postgres-20240101-000000.dump.zst":       ".dump",
+		"backup/testdb-postgres-20240101-000000.dir.tar.gz.age": ".dir.tar",
+		"backup/testdb-postgres-20240101-000000.tar.age":        ".tar",
+	}
+
+	for key, expected := range tests {
+		if extension := dumpExtension(key); extension != expected {
+			t.Errorf("Expected extension of %s to be %s, got %s", key, expected, extension)
+		}
+	}
+}
+
+// TestGlobalsCompanion tests that globals are grouped with their backup and removed with it
+func TestGlobalsCompanion(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	keys := []string{
+		"backup/testdb-postgres-20240101-000000.sql.gz",
+		"backup/testdb-postgres-20240101-000000.globals.sql.gz",
+		"backup/testdb-postgres-20240101-000000.manifest.json",
+		"backup/testdb-postgres-20240102-000000.sql.gz",
+	}
+	for _, key := range keys {
+		if err := backend.Upload(ctx, key, strings.NewReader("dump"), storage.UploadOptions{}); err != nil {
+			t.Fatalf("Failed to upload %s: %v", key, err)
+		}
+	}
+
+	cfg := &config.Config{
+		DBType:       config.PostgreSQL,
+		DBName:       "testdb",
+		KeepLast:     1,
+		BackupPrefix: "backup",
+	}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	backups, err := svc.listBackups(ctx, svc.backupKeyPrefix())
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	if len(backups) != 2 || len(backups[1].Companions) != 2 {
+		t.Fatalf("Expected the globals and manifest to be companions of the older backup, got %+v", backups)
+	}
+
+	if err := svc.cleanupOldBackups(ctx, false); err != nil {
+		t.Fatalf("Failed to cleanup old backups: %v", err)
+	}
+
+	objects, err := backend.List(ctx, "backup/")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+
+	if len(objects) != 1 || objects[0].Key != keys[3] {
+		t.Errorf("Expected only %s to remain, got %v", keys[3], objects)
+	}
+}
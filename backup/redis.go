@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// createRedisCliCmd creates a redis-cli command connected to the configured
+// server. The password is passed in the environment to keep it off the
+// command line.
+func (s *Service) createRedisCliCmd(ctx context.Context, args ...string) *exec.Cmd {
+	connArgs := []string{
+		"-h", s.cfg.DBHost,
+		"-p", s.cfg.DBPort,
+	}
+
+	// Authenticate as an ACL user instead of the default user
+	if s.cfg.DBUser != "" {
+		connArgs = append(connArgs, "--user", s.cfg.DBUser)
+	}
+
+	cmd := exec.CommandContext(ctx, "redis-cli", append(connArgs, args...)...)
+	if s.cfg.DBPassword != "" {
+		cmd.Env = append(os.Environ(), "REDISCLI_AUTH="+s.cfg.DBPassword)
+	}
+
+	return cmd
+}
+
+// createRedisDumpCmd creates a command fetching an RDB snapshot from the
+// server through the replication protocol and writing it to stdout
+func (s *Service) createRedisDumpCmd(ctx context.Context) *exec.Cmd {
+	return s.createRedisCliCmd(ctx, "--rdb", "-")
+}
+
+// redisServerVersion asks the Redis server for its version
+func (s *Service) redisServerVersion(ctx context.Context) string {
+	output, err := s.createRedisCliCmd(ctx, "INFO", "server").Output()
+	if err != nil {
+		return ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if version, ok := strings.CutPrefix(scanner.Text(), "redis_version:"); ok {
+			return strings.TrimSpace(version)
+		}
+	}
+
+	return ""
+}
+
+// restoreRedis writes the RDB snapshot read from r to the configured path.
+// Redis only loads snapshots on startup, so the target instance must be
+// started or restarted afterwards with this file as its dbfilename.
+func (s *Service) restoreRedis(r io.Reader) error {
+	if s.cfg.DBPath == "" {
+		return errors.New("DB_PATH must be set to restore a Redis snapshot")
+	}
+
+	// Write next to the target and rename, so a running instance never sees a partial file
+	dir := filepath.Dir(s.cfg.DBPath)
+	tmp, err := os.CreateTemp(dir, ".tmp-*.rdb")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	// Temporary files are private, but the Redis server usually runs as
+	// another user. Keep the mode of the replaced snapshot or make it readable.
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(s.cfg.DBPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to set snapshot permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.cfg.DBPath); err != nil {
+		return fmt.Errorf("failed to move snapshot into place: %w", err)
+	}
+
+	fmt.Printf("Wrote Redis snapshot to %s, start the target instance with it to load the data\n", s.cfg.DBPath)
+	return nil
+}
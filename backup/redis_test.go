@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// TestCreateRedisDumpCmd tests the arguments and environment passed to redis-cli
+func TestCreateRedisDumpCmd(t *testing.T) {
+	cfg := &config.Config{
+		DBType:     config.Redis,
+		DBHost:     "localhost",
+		DBPort:     "6379",
+		DBUser:     "backup",
+		DBPassword: "password",
+	}
+	svc := &Service{cfg: cfg}
+
+	cmd := svc.createRedisDumpCmd(context.Background())
+
+	expected := []string{"redis-cli", "-h", "localhost", "-p", "6379", "--user", "backup", "--rdb", "-"}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, cmd.Args)
+	}
+
+	// The password goes into the environment, not the arguments
+	if !slices.Contains(cmd.Env, "REDISCLI_AUTH=password") {
+		t.Error("Expected REDISCLI_AUTH environment variable to be set")
+	}
+}
+
+// TestRestoreRedis tests putting a snapshot in place for the target instance
+func TestRestoreRedis(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dump.rdb")
+
+	if err := os.WriteFile(target, []byte("old"), 0o640); err != nil {
+		t.Fatalf("Failed to write old snapshot: %v", err)
+	}
+	if err := os.Chmod(target, 0o640); err != nil {
+		t.Fatalf("Failed to set old snapshot permissions: %v", err)
+	}
+
+	cfg := &config.Config{
+		DBType: config.Redis,
+		DBPath: target,
+	}
+	svc := &Service{cfg: cfg}
+
+	if err := svc.restoreRedis(strings.NewReader("REDIS0011snapshot")); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if string(data) != "REDIS0011snapshot" {
+		t.Errorf("Expected snapshot to be replaced, got %q", data)
+	}
+
+	// The snapshot keeps the permissions of the replaced one
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("Failed to stat snapshot: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o640 {
+		t.Errorf("Expected snapshot permissions 0640, got %o", perm)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot in %s, got %d entries", dir, len(entries))
+	}
+}
+
+// TestRestoreRedisNewSnapshot tests that new snapshots are readable by the Redis server
+func TestRestoreRedisNewSnapshot(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "dump.rdb")
+	svc := &Service{cfg: &config.Config{DBType: config.Redis, DBPath: target}}
+
+	if err := svc.restoreRedis(strings.NewReader("REDIS0011snapshot")); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("Failed to stat snapshot: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o644 {
+		t.Errorf("Expected snapshot permissions 0644, got %o", perm)
+	}
+}
@@ -0,0 +1,240 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// PerformRestore downloads a backup from storage and streams it into the database.
+// The ref selects the backup: an empty ref picks the latest one, otherwise it
+// is matched against the full object key or the backup timestamp.
+func (s *Service) PerformRestore(ctx context.Context, ref string) error {
+	// Find the backup to restore
+	objName, err := s.findBackup(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Starting restore of %s into %s database %s at %s\n",
+		objName, s.cfg.DBType, s.cfg.DBName, time.Now().Format(time.RFC3339))
+
+	// Partial dumps rely on the database already holding the rest
+	contents, err := s.backupContents(ctx, objName)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if contents != nil {
+		fmt.Printf("The backup only contains part of the database: %s\n", contents)
+	}
+
+	// Stream the object straight into the client without touching local disk
+	reader, err := s.openBackup(ctx, objName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	credentials, cleanup, err := s.writeCredentials()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	// Execute the appropriate restore command based on database type
+	var cmd *exec.Cmd
+	switch s.cfg.DBType {
+	case config.MySQL:
+		cmd = s.createMySQLRestoreCmd(ctx, credentials)
+	case config.PostgreSQL:
+		// Only plain dumps are SQL scripts, the other formats need pg_restore
+		if dumpExtension(objName) != pgDumpFormats[config.PGDumpPlain].extension {
+			if err := s.restorePgArchive(ctx, credentials, objName, reader); err != nil {
+				return err
+			}
+			fmt.Printf("Restore completed successfully: %s\n", objName)
+			return nil
+		}
+		cmd = s.createPsqlRestoreCmd(ctx, credentials)
+	case config.MongoDB:
+		cmd = s.createMongoRestoreCmd(ctx, credentials)
+	case config.SQLite:
+		if err := s.restoreSQLite(ctx, reader); err != nil {
+			return err
+		}
+		fmt.Printf("Restore completed successfully: %s\n", objName)
+		return nil
+	case config.Redis:
+		if err := s.restoreRedis(reader); err != nil {
+			return err
+		}
+		fmt.Printf("Restore completed successfully: %s\n", objName)
+		return nil
+	default:
+		return fmt.Errorf("unsupported database type: %s", s.cfg.DBType)
+	}
+
+	// Create a buffer to capture stderr
+	var stderr bytes.Buffer
+
+	cmd.Stdin = reader
+	cmd.Stderr = &stderr
+
+	// Run the command
+	if err := cmd.Run(); err != nil {
+		errOutput := stderr.String()
+		fmt.Printf("Database restore error output: %s\n", errOutput)
+		return fmt.Errorf("database restore failed: %w (stderr: %s)", err, errOutput)
+	}
+
+	fmt.Printf("Restore completed successfully: %s\n", objName)
+	return nil
+}
+
+// DownloadBackup writes the decrypted and decompressed dump selected by ref
+// to w and returns the key of the downloaded backup. The ref is interpreted
+// the same way as for PerformRestore.
+func (s *Service) DownloadBackup(ctx context.Context, ref string, w io.Writer) (string, error) {
+	objName, err := s.findBackup(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := s.openBackup(ctx, objName)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(w, reader); err != nil {
+		return "", fmt.Errorf("failed to download backup %s: %w", objName, err)
+	}
+
+	return objName, nil
+}
+
+// findBackup returns the key of the backup of the configured database matching ref
+func (s *Service) findBackup(ctx context.Context, ref string) (string, error) {
+	if s.cfg.AllDatabases {
+		return "", errNoDatabase
+	}
+
+	backups, err := s.listBackups(ctx, s.backupKeyPrefix())
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, len(backups))
+	for i, backup := range backups {
+		keys[i] = backup.Key
+	}
+
+	return selectBackup(keys, s.backupKeyPrefix(), ref)
+}
+
+// openBackup opens the backup stored under objName and undoes encryption and
+// compression based on its key. The caller must close the returned reader.
+func (s *Service) openBackup(ctx context.Context, objName string) (io.ReadCloser, error) {
+	object, err := s.storage.Download(ctx, objName)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := newDecryptReader(object, objName, s.cfg.AgeIdentityFile)
+	if err != nil {
+		object.Close()
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+
+	decompressed, err := newDecompressReader(decrypted, objName)
+	if err != nil {
+		object.Close()
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+
+	return &backupReader{Reader: decompressed, closers: []io.Closer{decompressed, object}}, nil
+}
+
+// backupReader reads a decoded backup and closes every layer below it
+type backupReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *backupReader) Close() error {
+	var firstErr error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// backupKeyPrefix returns the key prefix shared by all backups of the configured database
+func (s *Service) backupKeyPrefix() string {
+	return fmt.Sprintf("%s/%s-%s-", s.cfg.BackupPrefix, s.cfg.DBName, s.cfg.DBType)
+}
+
+// selectBackup picks the backup matching ref from keys. Only keys starting with
+// prefix are considered. Backup keys end in a sortable timestamp, so the
+// lexically greatest key is the latest backup.
+func selectBackup(keys []string, prefix, ref string) (string, error) {
+	var candidates []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			candidates = append(candidates, key)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no backups found with prefix %s", prefix)
+	}
+
+	sort.Strings(candidates)
+
+	if ref == "" {
+		return candidates[len(candidates)-1], nil
+	}
+
+	for _, key := range candidates {
+		if key == ref || strings.HasPrefix(key, prefix+ref+".") {
+			return key, nil
+		}
+	}
+
+	return "", fmt.Errorf("no backup found matching %s", ref)
+}
+
+// createMySQLRestoreCmd creates a command to load a dump into a MySQL database
+func (s *Service) createMySQLRestoreCmd(ctx context.Context, credentials string) *exec.Cmd {
+	// Build mysql command
+	args := append(s.mysqlConnectionArgs(credentials), s.cfg.DBName)
+	cmd := exec.CommandContext(ctx, "mysql", args...)
+
+	return cmd
+}
+
+// createPsqlRestoreCmd creates a command to load a dump into a PostgreSQL database
+func (s *Service) createPsqlRestoreCmd(ctx context.Context, credentials string) *exec.Cmd {
+	// Build psql command, stopping at the first error instead of ploughing on
+	cmd := exec.CommandContext(ctx, "psql",
+		"--host", s.cfg.DBHost,
+		"--port", s.cfg.DBPort,
+		"--username", s.cfg.DBUser,
+		"--dbname", s.cfg.DBName,
+		"--set", "ON_ERROR_STOP=1",
+		"--quiet",
+	)
+	cmd.Env = s.pgEnv(credentials)
+
+	return cmd
+}
@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// TestSelectBackup tests picking a backup by key, timestamp or recency
+func TestSelectBackup(t *testing.T) {
+	keys := []string{
+		"backup/testdb-mysql-20240102-000000.sql",
+		"backup/testdb-mysql-20240103-000000.sql",
+		"backup/otherdb-mysql-20240104-000000.sql",
+		"backup/testdb-mysql-20240101-000000.sql",
+	}
+	prefix := "backup/testdb-mysql-"
+
+	tests := []struct {
+		name     string
+		ref      string
+		expected string
+	}{
+		{"latest", "", "backup/testdb-mysql-20240103-000000.sql"},
+		{"timestamp", "20240102-000000", "backup/testdb-mysql-20240102-000000.sql"},
+		{"key", "backup/testdb-mysql-20240101-000000.sql", "backup/testdb-mysql-20240101-000000.sql"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := selectBackup(keys, prefix, tt.ref)
+			if err != nil {
+				t.Fatalf("Failed to select backup: %v", err)
+			}
+			if key != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, key)
+			}
+		})
+	}
+
+	// A backup of another database must never be selected
+	if _, err := selectBackup(keys, prefix, "20240104-000000"); err == nil {
+		t.Error("Expected error for backup of another database, got nil")
+	}
+
+	if _, err := selectBackup(nil, prefix, ""); err == nil {
+		t.Error("Expected error when no backups exist, got nil")
+	}
+}
+
+// TestCreatePsqlRestoreCmd tests the creation of the PostgreSQL restore command
+func TestCreatePsqlRestoreCmd(t *testing.T) {
+	// Create a test configuration
+	cfg := &config.Config{
+		DBType:     config.PostgreSQL,
+		DBHost:     "localhost",
+		DBPort:     "5432",
+		DBName:     "testdb",
+		DBUser:     "user",
+		DBPassword: "password",
+	}
+
+	// Create a service with the test configuration
+	svc := &Service{cfg: cfg}
+
+	// Create the PostgreSQL restore command
+	cmd := svc.createPsqlRestoreCmd(context.Background(), "/tmp/credentials")
+
+	// Check that the command has the right arguments
+	args := cmd.Args
+	expectedArgs := []string{
+		"psql",
+		"--host", "localhost",
+		"--port", "5432",
+		"--username", "user",
+		"--dbname", "testdb",
+		"--set", "ON_ERROR_STOP=1",
+		"--quiet",
+	}
+
+	if len(args) != len(expectedArgs) {
+		t.Errorf("Expected %d arguments, got %d", len(expectedArgs), len(args))
+	}
+
+	// Check each argument
+	for i, expected := range expectedArgs {
+		if i < len(args) && args[i] != expected {
+			t.Errorf("Expected argument %d to be '%s', got '%s'", i, expected, args[i])
+		}
+	}
+}
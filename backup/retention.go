@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// retentionRule selects the newest backup of up to keep periods
+type retentionRule struct {
+	// name is the setting configuring the rule
+	name string
+	keep int
+	// period returns the period a backup falls into, nil selects every backup
+	period func(time.Time) string
+}
+
+// retentionRules returns the configured retention rules
+func (s *Service) retentionRules() []retentionRule {
+	return []retentionRule{
+		{name: "KEEP_LAST", keep: s.cfg.KeepLast},
+		{name: "KEEP_DAILY", keep: s.cfg.KeepDaily, period: func(t time.Time) string {
+			return t.Format("2006-01-02")
+		}},
+		{name: "KEEP_WEEKLY", keep: s.cfg.KeepWeekly, period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{name: "KEEP_MONTHLY", keep: s.cfg.KeepMonthly, period: func(t time.Time) string {
+			return t.Format("2006-01")
+		}},
+		{name: "KEEP_YEARLY", keep: s.cfg.KeepYearly, period: func(t time.Time) string {
+			return t.Format("2006")
+		}},
+	}
+}
+
+// retentionPolicy describes the configured retention rules, such as
+// "KEEP_LAST=3, KEEP_DAILY=7"
+func (s *Service) retentionPolicy() string {
+	var rules []string
+	for _, rule := range s.retentionRules() {
+		if rule.keep > 0 {
+			rules = append(rules, fmt.Sprintf("%s=%d", rule.name, rule.keep))
+		}
+	}
+
+	return strings.Join(rules, ", ")
+}
+
+// applyRetention returns for each backup the settings of the retention rules
+// that keep it. Backups without any rule are due for pruning. The rules apply
+// to the backups of each database separately. The backups must be sorted
+// newest first, as returned by listBackups.
+func (s *Service) applyRetention(backups []Backup) [][]string {
+	keptBy := make([][]string, len(backups))
+
+	for _, rule := range s.retentionRules() {
+		kept := make(map[string]int)
+		last := make(map[string]string)
+		for i, backup := range backups {
+			database := backup.DBName + "-" + backup.DBType
+			if kept[database] >= rule.keep {
+				continue
+			}
+
+			// Only the newest backup of each period counts
+			if rule.period != nil {
+				period := rule.period(backup.Timestamp)
+				if period == last[database] {
+					continue
+				}
+				last[database] = period
+			}
+
+			keptBy[i] = append(keptBy[i], rule.name)
+			kept[database]++
+		}
+	}
+
+	return keptBy
+}
@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// TestApplyRetention tests combining the last and periodic retention rules
+func TestApplyRetention(t *testing.T) {
+	// Two backups a day from 2024-01-01 to 2024-02-29, newest first
+	var backups []Backup
+	for day := time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC); !day.Before(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); day = day.AddDate(0, 0, -1) {
+		backups = append(backups,
+			Backup{Key: day.Format(timestampFormat) + "-evening", Timestamp: day.Add(18 * time.Hour)},
+			Backup{Key: day.Format(timestampFormat) + "-morning", Timestamp: day.Add(6 * time.Hour)},
+		)
+	}
+
+	cfg := &config.Config{
+		KeepLast:    3,
+		KeepDaily:   2,
+		KeepWeekly:  2,
+		KeepMonthly: 3,
+	}
+	svc := &Service{cfg: cfg}
+
+	keptBy := svc.applyRetention(backups)
+
+	kept := make(map[string][]string)
+	for i, backup := range backups {
+		if len(keptBy[i]) > 0 {
+			kept[backup.Key] = keptBy[i]
+		}
+	}
+
+	expected := map[string][]string{
+		// Newest backup of 2024-02-29, also the newest of its week and month
+		"20240229-000000-evening": {"KEEP_LAST", "KEEP_DAILY", "KEEP_WEEKLY", "KEEP_MONTHLY"},
+		"20240229-000000-morning": {"KEEP_LAST"},
+		"20240228-000000-evening": {"KEEP_LAST", "KEEP_DAILY"},
+		// Newest backup of the week before, 2024-02-19 to 2024-02-25
+		"20240225-000000-evening": {"KEEP_WEEKLY"},
+		// Newest backup of January, only two months exist
+		"20240131-000000-evening": {"KEEP_MONTHLY"},
+	}
+
+	if !reflect.DeepEqual(kept, expected) {
+		t.Errorf("Expected kept backups %v, got %v", expected, kept)
+	}
+}
+
+// TestPruneDryRun tests that a dry run doesn't delete anything
+func TestPruneDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	keys := []string{
+		"backup/testdb-mysql-20240101-000000.sql",
+		"backup/testdb-mysql-20240101-000000.manifest.json",
+		"backup/testdb-mysql-20240102-000000.sql",
+	}
+	for _, key := range keys {
+		if err := backend.Upload(ctx, key, strings.NewReader("dump"), storage.UploadOptions{}); err != nil {
+			t.Fatalf("Failed to upload %s: %v", key, err)
+		}
+	}
+
+	cfg := &config.Config{
+		DBType:       config.MySQL,
+		DBName:       "testdb",
+		KeepLast:     1,
+		BackupPrefix: "backup",
+	}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	if err := svc.Prune(ctx, true); err != nil {
+		t.Fatalf("Failed to prune backups: %v", err)
+	}
+
+	objects, err := backend.List(ctx, "backup/")
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	if len(objects) != len(keys) {
+		t.Errorf("Expected dry run to keep all %d objects, got %d", len(keys), len(objects))
+	}
+
+	if err := svc.Prune(ctx, false); err != nil {
+		t.Fatalf("Failed to prune backups: %v", err)
+	}
+
+	objects, err = backend.List(ctx, "backup/")
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	if len(objects) != 1 || objects[0].Key != keys[2] {
+		t.Errorf("Expected only %s to remain, got %v", keys[2], objects)
+	}
+}
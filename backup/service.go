@@ -3,122 +3,409 @@ package backup
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 	"time"
 
+	"filippo.io/age"
 	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/metrics"
 	"github.com/nilsmarti/go-dbdumper/storage"
 )
 
 // Service handles database backup operations
 type Service struct {
-	cfg       *config.Config
-	s3Client  *storage.S3Client
+	cfg        *config.Config
+	storage    storage.Backend
+	recipients []age.Recipient
 }
 
 // NewService creates a new backup service
 func NewService(cfg *config.Config) (*Service, error) {
-	// Initialize S3 client
-	s3Client, err := storage.NewS3Client(cfg)
+	// Initialize storage backend
+	backend, err := storage.New(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize S3 client: %w", err)
+		return nil, fmt.Errorf("failed to initialize %s storage: %w", cfg.StorageType, err)
 	}
 
+	// Parse the age recipients backups are encrypted to
+	recipients, err := parseRecipients(cfg.AgeRecipients)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.RegisterJob(cfg.Name)
+
 	return &Service{
-		cfg:      cfg,
-		s3Client: s3Client,
+		cfg:        cfg,
+		storage:    backend,
+		recipients: recipients,
 	}, nil
 }
 
-// PerformBackup performs a database backup and uploads it to S3
-func (s *Service) PerformBackup() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+// PerformBackup performs a database backup and uploads it to the storage backend.
+// Cancelling ctx kills the dump and aborts the upload.
+func (s *Service) PerformBackup(ctx context.Context) error {
+	start := time.Now()
+
+	// Pick up rotated secrets, the storage backend reads them from the configuration too
+	var size int64
+	err := s.cfg.RefreshSecrets()
+	if err != nil {
+		err = fmt.Errorf("failed to refresh secrets: %w", err)
+	} else if s.cfg.AllDatabases {
+		size, err = s.performAllBackups(ctx)
+	} else {
+		size, err = s.performBackup(ctx)
+	}
+	metrics.ObserveBackup(s.cfg.Name, time.Since(start), size, err)
+
+	return err
+}
+
+// performBackup runs the backup and returns the number of bytes stored
+func (s *Service) performBackup(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
 	defer cancel()
 
-	fmt.Printf("Starting backup of %s database %s at %s\n", 
-		s.cfg.DBType, s.cfg.DBName, time.Now().Format(time.RFC3339))
+	start := time.Now().UTC()
+	fmt.Printf("Starting backup of %s database %s at %s\n",
+		s.cfg.DBType, s.cfg.DBName, start.Format(time.RFC3339))
+	if contents := s.dumpContents(); contents != nil {
+		fmt.Printf("Dumping only part of the database: %s\n", contents)
+	}
+
+	// Describe the backup in its manifest
+	manifest := &Manifest{
+		Compression:     string(s.cfg.Compression),
+		Encrypted:       len(s.recipients) > 0,
+		DBType:          string(s.cfg.DBType),
+		DBName:          s.cfg.DBName,
+		DumpTool:        s.dumpTool(),
+		DumpToolVersion: s.dumpToolVersion(ctx),
+		ServerVersion:   s.serverVersion(ctx),
+		Contents:        s.dumpContents(),
+		StartTime:       start,
+		DumperVersion:   Version,
+	}
 
-	// Create a pipe to stream the dump directly to S3
+	// Create a pipe to stream the dump directly to storage
 	pr, pw := io.Pipe()
 
-	// Start the upload process in a goroutine
-	var uploadErr error
-	var objName string
+	// Start the dump process in a goroutine
+	dumpDone := make(chan struct{})
 	go func() {
+		defer close(dumpDone)
 		defer pw.Close()
-		
-		// Execute the appropriate dump command based on database type
-		var cmd *exec.Cmd
-		switch s.cfg.DBType {
-		case config.MySQL:
-			cmd = s.createMySQLDumpCmd()
-		case config.PostgreSQL:
-			cmd = s.createPgDumpCmd()
-		default:
-			pw.CloseWithError(fmt.Errorf("unsupported database type: %s", s.cfg.DBType))
+
+		// Compress and then encrypt the dump on its way into the pipe
+		encryptor, err := newEncryptWriter(pw, s.recipients)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to create encryptor: %w", err))
 			return
 		}
 
-		// Create a buffer to capture stderr
-		var stderr bytes.Buffer
+		compressor, err := newCompressWriter(encryptor, s.cfg.Compression, s.cfg.CompressionLevel)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to create compressor: %w", err))
+			return
+		}
 
-		// Set the output to the pipe writer and capture stderr
-		cmd.Stdout = pw
-		cmd.Stderr = &stderr
+		// Dump into the compressor, counting the dump size
+		if err := s.dump(ctx, &countingWriter{writer: compressor, n: &manifest.Size}); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
 
-		// Run the command
-		if err := cmd.Run(); err != nil {
-			errOutput := stderr.String()
-			fmt.Printf("Database dump error output: %s\n", errOutput)
-			pw.CloseWithError(fmt.Errorf("database dump failed: %w (stderr: %s)", err, errOutput))
+		// Flush the remaining compressed and encrypted data
+		if err := compressor.Close(); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to compress dump: %w", err))
+			return
+		}
+		if err := encryptor.Close(); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to encrypt dump: %w", err))
 		}
 	}()
 
-	// Upload the backup to S3
-	objName, uploadErr = s.s3Client.UploadBackup(ctx, pr, s.cfg.DBName, string(s.cfg.DBType))
-	if uploadErr != nil {
-		return fmt.Errorf("failed to upload backup: %w", uploadErr)
+	// Create the object name with format: prefix/dbname-dbtype-timestamp.ext[.gz|.zst][.age]
+	dump := s.dumpFormat()
+	format := compressionFormats[s.cfg.Compression]
+	objName := s.backupKeyPrefix() + start.Format(timestampFormat) + dump.extension + format.extension
+
+	opts := storage.UploadOptions{
+		ContentType:     dump.contentType,
+		ContentEncoding: format.contentEncoding,
+	}
+
+	// Encrypted objects are opaque, so they must not advertise their content
+	if len(s.recipients) > 0 {
+		objName += encryptedExtension
+		opts = storage.UploadOptions{ContentType: "application/octet-stream"}
+	}
+
+	// Let restores know when the dump only holds part of the database
+	opts.Metadata = manifest.Contents.metadata()
+
+	// Upload the backup, counting and hashing the stored bytes
+	hash := sha256.New()
+	counter := &countingReader{reader: io.TeeReader(pr, hash)}
+	if err := s.storage.Upload(ctx, objName, counter, opts); err != nil {
+		// Stop the dump if it is still writing into the pipe and wait for it to exit
+		pr.CloseWithError(err)
+		cancel()
+		<-dumpDone
+		return 0, fmt.Errorf("failed to upload backup: %w", err)
+	}
+	<-dumpDone
+
+	// Store the cluster globals next to the backup. The backup itself is
+	// complete, so a failure is only reported once the manifest is written.
+	var globalsErr error
+	if s.cfg.PGDumpGlobals {
+		manifest.GlobalsKey, globalsErr = s.backupGlobals(ctx, objName)
+	}
+
+	// Store the manifest next to the backup
+	manifest.Key = objName
+	manifest.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	manifest.CompressedSize = counter.n
+	manifest.EndTime = time.Now().UTC()
+	manifest.DurationSeconds = manifest.EndTime.Sub(start).Seconds()
+	if err := s.writeManifest(ctx, objName, manifest); err != nil {
+		// The backup itself is complete, so just log the error
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	// Clean up old backups
+	if err := s.cleanupOldBackups(ctx, false); err != nil {
+		// Just log the error but don't fail the backup
+		fmt.Printf("Warning: failed to cleanup old backups: %v\n", err)
+	}
+
+	if globalsErr != nil {
+		return counter.n, fmt.Errorf("backup %s was stored without globals: %w", objName, globalsErr)
 	}
 
 	fmt.Printf("Backup completed successfully: %s\n", objName)
+	return counter.n, nil
+}
+
+// Prune applies the retention policy outside of a backup run. With dryRun
+// set, it only prints which backups would be removed and why.
+func (s *Service) Prune(ctx context.Context, dryRun bool) error {
+	return s.cleanupOldBackups(ctx, dryRun)
+}
+
+// cleanupOldBackups removes the backups not kept by any retention rule
+func (s *Service) cleanupOldBackups(ctx context.Context, dryRun bool) error {
+	// List all backups of this job
+	backups, err := s.jobBackups(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Remove every backup no retention rule keeps
+	keptBy := s.applyRetention(backups)
+	for i, backup := range backups {
+		if dryRun {
+			if len(keptBy[i]) > 0 {
+				fmt.Printf("Would keep backup: %s (kept by %s)\n", backup.Key, strings.Join(keptBy[i], ", "))
+				continue
+			}
+			fmt.Printf("Would remove old backup: %s (not kept by %s)\n", backup.Key, s.retentionPolicy())
+			for _, companion := range backup.Companions {
+				fmt.Printf("Would remove companion: %s\n", companion)
+			}
+			continue
+		}
+
+		if len(keptBy[i]) > 0 {
+			continue
+		}
+		if err := s.deleteBackup(ctx, backup); err != nil {
+			return err
+		}
+		fmt.Printf("Removed old backup: %s\n", backup.Key)
+		metrics.ObserveRetentionDeletion(s.cfg.Name)
+	}
+
 	return nil
 }
 
-// createMySQLDumpCmd creates a command to dump a MySQL database
-func (s *Service) createMySQLDumpCmd() *exec.Cmd {
+// deleteBackup removes a backup together with its companion objects.
+// The backup goes last, so a failed deletion leaves it discoverable for the next attempt.
+func (s *Service) deleteBackup(ctx context.Context, backup Backup) error {
+	for _, objName := range append(backup.Companions, backup.Key) {
+		if err := s.storage.Delete(ctx, objName); err != nil {
+			return fmt.Errorf("failed to remove old backup %s: %w", objName, err)
+		}
+	}
+
+	return nil
+}
+
+// dump writes a dump of the configured database to w
+func (s *Service) dump(ctx context.Context, w io.Writer) error {
+	// Execute the appropriate dump command based on database type
+	credentials, cleanup, err := s.writeCredentials()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var cmd *exec.Cmd
+	switch s.cfg.DBType {
+	case config.MySQL:
+		cmd = s.createMySQLDumpCmd(ctx, credentials)
+	case config.PostgreSQL:
+		if s.pgDumpFormat() == config.PGDumpDirectory {
+			return s.dumpPgDirectory(ctx, credentials, w)
+		}
+		cmd = s.createPgDumpCmd(ctx, credentials)
+	case config.MongoDB:
+		cmd = s.createMongoDumpCmd(ctx, credentials)
+	case config.Redis:
+		cmd = s.createRedisDumpCmd(ctx)
+	case config.SQLite:
+		return s.dumpSQLite(ctx, w)
+	default:
+		return fmt.Errorf("unsupported database type: %s", s.cfg.DBType)
+	}
+
+	// Create a buffer to capture stderr
+	var stderr bytes.Buffer
+
+	// Set the output to w and capture stderr
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	// Run the command
+	if err := cmd.Run(); err != nil {
+		errOutput := stderr.String()
+		fmt.Printf("Database dump error output: %s\n", errOutput)
+		return fmt.Errorf("database dump failed: %w (stderr: %s)", err, errOutput)
+	}
+
+	return nil
+}
+
+// dumpFormat describes the output of a dump tool
+type dumpFormat struct {
+	extension   string
+	contentType string
+}
+
+// dumpFormat returns the format of the dumps of the configured database
+func (s *Service) dumpFormat() dumpFormat {
+	switch s.cfg.DBType {
+	case config.PostgreSQL:
+		return pgDumpFormats[s.pgDumpFormat()]
+	case config.MongoDB:
+		return dumpFormat{extension: ".archive", contentType: "application/octet-stream"}
+	case config.Redis:
+		return dumpFormat{extension: ".rdb", contentType: "application/octet-stream"}
+	case config.SQLite:
+		return dumpFormat{extension: ".sqlite", contentType: "application/vnd.sqlite3"}
+	default:
+		return dumpFormat{extension: ".sql", contentType: "application/sql"}
+	}
+}
+
+// createMySQLDumpCmd creates a command to dump a MySQL database, reading the
+// password from the option file at credentials
+func (s *Service) createMySQLDumpCmd(ctx context.Context, credentials string) *exec.Cmd {
 	// Build mysqldump command
-	cmd := exec.Command("mysqldump",
-		"--host", s.cfg.DBHost,
-		"--port", s.cfg.DBPort,
-		"--user", s.cfg.DBUser,
-		"--password=" + s.cfg.DBPassword, // Note: This is secure in this context as we're not exposing it to shell history
+	args := append(s.mysqlConnectionArgs(credentials),
 		"--single-transaction",
 		"--quick",
 		"--lock-tables=false",
-		"--default-auth=mysql_native_password", // Use native password authentication for MySQL 8+ compatibility
-		s.cfg.DBName,
 	)
 
-	return cmd
+	switch s.cfg.DumpMode {
+	case config.DumpSchemaOnly:
+		args = append(args, "--no-data")
+	case config.DumpDataOnly:
+		args = append(args, "--no-create-info")
+	}
+
+	// Excluded tables must be qualified with the database name
+	for _, table := range s.cfg.TableExclude {
+		args = append(args, "--ignore-table="+s.cfg.DBName+"."+table)
+	}
+
+	// Tables to dump follow the database name, all tables are dumped without any
+	args = append(args, s.cfg.DBName)
+	args = append(args, s.cfg.TableInclude...)
+
+	return exec.CommandContext(ctx, "mysqldump", args...)
 }
 
-// createPgDumpCmd creates a command to dump a PostgreSQL database
-func (s *Service) createPgDumpCmd() *exec.Cmd {
+// createPgDumpCmd creates a command to dump a PostgreSQL database, reading the
+// password from the password file at credentials
+func (s *Service) createPgDumpCmd(ctx context.Context, credentials string) *exec.Cmd {
 	// Build pg_dump command
-	cmd := exec.Command("pg_dump",
+	args := []string{
 		"--host", s.cfg.DBHost,
 		"--port", s.cfg.DBPort,
 		"--username", s.cfg.DBUser,
 		"--dbname", s.cfg.DBName,
-		"--format", "plain",
+		"--format", string(s.pgDumpFormat()),
 		"--no-owner",
 		"--no-acl",
-	)
+	}
 
-	// Set PGPASSWORD environment variable
-	cmd.Env = append(cmd.Env, "PGPASSWORD="+s.cfg.DBPassword)
+	switch s.cfg.DumpMode {
+	case config.DumpSchemaOnly:
+		args = append(args, "--schema-only")
+	case config.DumpDataOnly:
+		args = append(args, "--data-only")
+	}
+
+	// Filters take pg_dump patterns and can be given multiple times
+	for _, filter := range []struct {
+		flag     string
+		patterns []string
+	}{
+		{"--table", s.cfg.TableInclude},
+		{"--exclude-table", s.cfg.TableExclude},
+		{"--schema", s.cfg.SchemaInclude},
+		{"--exclude-schema", s.cfg.SchemaExclude},
+	} {
+		for _, pattern := range filter.patterns {
+			args = append(args, filter.flag+"="+pattern)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "pg_dump", args...)
+	cmd.Env = s.pgEnv(credentials)
 
 	return cmd
 }
+
+// countingWriter counts the bytes written through it into n
+type countingWriter struct {
+	writer io.Writer
+	n      *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -1,28 +1,35 @@
 package backup
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
 )
 
 // TestCreateMySQLDumpCmd tests the creation of MySQL dump command
 func TestCreateMySQLDumpCmd(t *testing.T) {
 	// Create a test configuration
 	cfg := &config.Config{
-		DBType:     config.MySQL,
-		DBHost:     "localhost",
-		DBPort:     "3306",
-		DBName:     "testdb",
-		DBUser:     "user",
-		DBPassword: "password",
+		DBType:           config.MySQL,
+		DBHost:           "localhost",
+		DBPort:           "3306",
+		DBName:           "testdb",
+		DBUser:           "user",
+		DBPassword:       "password",
+		MySQLDefaultAuth: "mysql_native_password",
 	}
 
 	// Create a service with the test configuration
 	svc := &Service{cfg: cfg}
 
 	// Create the MySQL dump command
-	cmd := svc.createMySQLDumpCmd()
+	cmd := svc.createMySQLDumpCmd(context.Background(), "/tmp/credentials")
 
 	// Verify the command
 	if cmd.Path == "" {
@@ -33,14 +40,14 @@ func TestCreateMySQLDumpCmd(t *testing.T) {
 	args := cmd.Args
 	expectedArgs := []string{
 		"mysqldump",
+		"--defaults-extra-file=/tmp/credentials",
 		"--host", "localhost",
 		"--port", "3306",
 		"--user", "user",
-		"--password=password",
+		"--default-auth=mysql_native_password",
 		"--single-transaction",
 		"--quick",
 		"--lock-tables=false",
-		"--default-auth=mysql_native_password",
 		"testdb",
 	}
 
@@ -65,14 +72,14 @@ func TestCreatePgDumpCmd(t *testing.T) {
 		DBPort:     "5432",
 		DBName:     "testdb",
 		DBUser:     "user",
-		DBPassword: "password",
+		DBPassword: "s3cr3t",
 	}
 
 	// Create a service with the test configuration
 	svc := &Service{cfg: cfg}
 
 	// Create the PostgreSQL dump command
-	cmd := svc.createPgDumpCmd()
+	cmd := svc.createPgDumpCmd(context.Background(), "/tmp/credentials")
 
 	// Verify the command
 	if cmd.Path == "" {
@@ -103,17 +110,93 @@ func TestCreatePgDumpCmd(t *testing.T) {
 		}
 	}
 
-	// Check that PGPASSWORD environment variable is set
+	// Check that the password is read from the password file
 	envs := cmd.Env
-	pgPasswordFound := false
+	pgPassFileFound := false
 	for _, env := range envs {
-		if env == "PGPASSWORD=password" {
-			pgPasswordFound = true
-			break
+		if env == "PGPASSFILE=/tmp/credentials" {
+			pgPassFileFound = true
+		}
+		if strings.HasSuffix(env, "="+cfg.DBPassword) {
+			t.Errorf("Expected the password to stay out of the environment, got %s", env)
+		}
+	}
+
+	if !pgPassFileFound {
+		t.Error("Expected PGPASSFILE environment variable to be set")
+	}
+}
+
+// TestCleanupOldBackups tests that only the latest backups are kept
+func TestCleanupOldBackups(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	backend, err := storage.NewLocalBackend(root)
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	cfg := &config.Config{
+		DBType:       config.MySQL,
+		DBName:       "testdb",
+		KeepLast:     2,
+		BackupPrefix: "backup",
+	}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	// Create four backups with increasing modification times
+	keys := []string{
+		"backup/testdb-mysql-20240101-000000.sql",
+		"backup/testdb-mysql-20240102-000000.sql",
+		"backup/testdb-mysql-20240103-000000.sql",
+		"backup/testdb-mysql-20240104-000000.sql",
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, key := range keys {
+		if err := backend.Upload(ctx, key, strings.NewReader("dump"), storage.UploadOptions{}); err != nil {
+			t.Fatalf("Failed to upload %s: %v", key, err)
+		}
+		modTime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(root, key), modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	// Manifests are removed together with their backups
+	for _, key := range []string{keys[0], keys[3]} {
+		manifestKey := strings.TrimSuffix(key, ".sql") + ".manifest.json"
+		if err := backend.Upload(ctx, manifestKey, strings.NewReader("{}"), storage.UploadOptions{}); err != nil {
+			t.Fatalf("Failed to upload manifest: %v", err)
 		}
 	}
 
-	if !pgPasswordFound {
-		t.Error("Expected PGPASSWORD environment variable to be set")
+	// Backups of other databases must not be touched
+	if err := backend.Upload(ctx, "backup/otherdb-mysql-20240101-000000.sql", strings.NewReader("dump"), storage.UploadOptions{}); err != nil {
+		t.Fatalf("Failed to upload backup: %v", err)
+	}
+
+	if err := svc.cleanupOldBackups(ctx, false); err != nil {
+		t.Fatalf("Failed to cleanup old backups: %v", err)
+	}
+
+	objects, err := backend.List(ctx, "backup/")
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	remaining := make(map[string]bool)
+	for _, object := range objects {
+		remaining[object.Key] = true
+	}
+
+	expected := []string{keys[2], keys[3], "backup/testdb-mysql-20240104-000000.manifest.json", "backup/otherdb-mysql-20240101-000000.sql"}
+	if len(remaining) != len(expected) {
+		t.Errorf("Expected %d backups to remain, got %d", len(expected), len(remaining))
+	}
+	for _, key := range expected {
+		if !remaining[key] {
+			t.Errorf("Expected %s to be kept", key)
+		}
 	}
 }
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// dumpSQLite writes a consistent snapshot of the configured SQLite database
+// to w. The snapshot is taken with SQLite's online backup API into a
+// temporary file, so writers can keep using the database meanwhile.
+func (s *Service) dumpSQLite(ctx context.Context, w io.Writer) error {
+	// Don't let sqlite3 create an empty database if the path is wrong
+	if _, err := os.Stat(s.cfg.DBPath); err != nil {
+		return fmt.Errorf("failed to access database file: %w", err)
+	}
+
+	snapshot, err := createTempFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshot)
+
+	if err := runSQLite(s.createSQLiteBackupCmd(ctx, snapshot)); err != nil {
+		return fmt.Errorf("database dump failed: %w", err)
+	}
+
+	file, err := os.Open(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to open database snapshot: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to read database snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// restoreSQLite replaces the contents of the configured SQLite database with
+// the snapshot read from r. The snapshot is written to a temporary file first,
+// since SQLite can only restore from a database file.
+func (s *Service) restoreSQLite(ctx context.Context, r io.Reader) error {
+	snapshot, err := createTempFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(snapshot)
+
+	file, err := os.OpenFile(snapshot, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open database snapshot: %w", err)
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write database snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write database snapshot: %w", err)
+	}
+
+	if err := runSQLite(s.createSQLiteRestoreCmd(ctx, snapshot)); err != nil {
+		return fmt.Errorf("database restore failed: %w", err)
+	}
+
+	return nil
+}
+
+// createSQLiteBackupCmd creates a command copying the configured database to
+// the file at snapshot using the online backup API
+func (s *Service) createSQLiteBackupCmd(ctx context.Context, snapshot string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sqlite3", "-bail", s.cfg.DBPath, ".backup "+sqliteQuote(snapshot))
+}
+
+// createSQLiteRestoreCmd creates a command replacing the contents of the
+// configured database with the database file at snapshot
+func (s *Service) createSQLiteRestoreCmd(ctx context.Context, snapshot string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sqlite3", "-bail", s.cfg.DBPath, ".restore "+sqliteQuote(snapshot))
+}
+
+// runSQLite runs a sqlite3 command, returning its error output on failure
+func runSQLite(cmd *exec.Cmd) error {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		errOutput := output.String()
+		fmt.Printf("Database error output: %s\n", errOutput)
+		return fmt.Errorf("%w (output: %s)", err, errOutput)
+	}
+
+	return nil
+}
+
+// createTempFile creates an empty temporary file for a database snapshot and
+// returns its path
+func createTempFile() (string, error) {
+	file, err := os.CreateTemp("", "dbdumper-*.sqlite")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	file.Close()
+
+	return file.Name(), nil
+}
+
+// sqliteQuote quotes an argument of a sqlite3 dot command. Single quoted
+// arguments end at the next single quote without any escaping, so arguments
+// are double quoted, where the shell resolves backslash escapes.
+func sqliteQuote(arg string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(arg) + `"`
+}
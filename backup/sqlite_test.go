@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// TestSQLiteBackupAndRestore tests backing up a SQLite database and restoring it
+func TestSQLiteBackupAndRestore(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+
+	sqlite := func(sql string) string {
+		output, err := exec.Command("sqlite3", dbPath, sql).CombinedOutput()
+		if err != nil {
+			t.Fatalf("Failed to run %q: %v (%s)", sql, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	sqlite("CREATE TABLE t (v TEXT); INSERT INTO t VALUES ('before');")
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	cfg := &config.Config{
+		Name:         "sqlite",
+		DBType:       config.SQLite,
+		DBName:       "app",
+		DBPath:       dbPath,
+		KeepLast:     1,
+		BackupPrefix: "backup",
+		Compression:  config.CompressionGzip,
+	}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	if err := svc.PerformBackup(ctx); err != nil {
+		t.Fatalf("Failed to perform backup: %v", err)
+	}
+
+	backups, err := svc.ListBackups(ctx, false)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 || !strings.HasSuffix(backups[0].Key, ".sqlite.gz") {
+		t.Fatalf("Expected a single .sqlite.gz backup, got %v", backups)
+	}
+
+	// Change the database and restore the backup over it
+	sqlite("UPDATE t SET v = 'after';")
+
+	if err := svc.PerformRestore(ctx, ""); err != nil {
+		t.Fatalf("Failed to perform restore: %v", err)
+	}
+
+	if v := sqlite("SELECT v FROM t;"); v != "before" {
+		t.Errorf("Expected restored value to be before, got %s", v)
+	}
+}
+
+// TestSQLiteQuote tests that dot command arguments keep quotes and backslashes
+func TestSQLiteQuote(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	if output, err := exec.Command("sqlite3", dbPath, "CREATE TABLE t (v TEXT);").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create database: %v (%s)", err, output)
+	}
+
+	svc := &Service{cfg: &config.Config{DBType: config.SQLite, DBPath: dbPath}}
+	snapshot := filepath.Join(dir, `it's a "snapshot" \ copy.db`)
+	if err := runSQLite(svc.createSQLiteBackupCmd(context.Background(), snapshot)); err != nil {
+		t.Fatalf("Failed to back up to %s: %v", snapshot, err)
+	}
+
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Errorf("Expected snapshot at %s: %v", snapshot, err)
+	}
+}
@@ -0,0 +1,205 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// tailSize is how much of the end of a dump is kept to look for the completion marker
+const tailSize = 4096
+
+// VerifyResult is the outcome of verifying a single backup
+type VerifyResult struct {
+	Key string
+	// Size is the size of the stored object
+	Size int64
+	// DumpSize is the size of the decoded dump
+	DumpSize int64
+	// Problems are reasons the backup failed verification
+	Problems []string
+	// Warnings are checks that couldn't be performed
+	Warnings []string
+}
+
+// OK reports whether the backup passed verification
+func (r VerifyResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// VerifyBackups verifies the backup selected by ref, or all backups of the
+// job if all is set. The ref is interpreted the same way as for
+// PerformRestore.
+func (s *Service) VerifyBackups(ctx context.Context, ref string, all bool) ([]VerifyResult, error) {
+	if !all && s.cfg.AllDatabases {
+		return nil, errNoDatabase
+	}
+
+	backups, err := s.jobBackups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !all {
+		keys := make([]string, len(backups))
+		for i, backup := range backups {
+			keys[i] = backup.Key
+		}
+
+		key, err := selectBackup(keys, s.backupKeyPrefix(), ref)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, backup := range backups {
+			if backup.Key == key {
+				backups = []Backup{backup}
+				break
+			}
+		}
+	}
+
+	var results []VerifyResult
+	for _, backup := range backups {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		results = append(results, s.verifyBackup(ctx, backup))
+	}
+
+	return results, nil
+}
+
+// verifyBackup streams a backup, recomputes its checksum and decodes it to the
+// end to make sure it is complete
+func (s *Service) verifyBackup(ctx context.Context, backup Backup) VerifyResult {
+	result := VerifyResult{Key: backup.Key}
+
+	manifest, err := s.readManifest(ctx, backup)
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+	} else if manifest == nil {
+		result.Warnings = append(result.Warnings, "no manifest, checksum not verified")
+	}
+
+	object, err := s.storage.Download(ctx, backup.Key)
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+		return result
+	}
+	defer object.Close()
+
+	// Hash and count the stored bytes while they are decoded
+	hash := sha256.New()
+	stored := &countingReader{reader: io.TeeReader(object, hash)}
+
+	tail, dumpSize, err := s.decodeToEnd(stored, backup.Key)
+	result.DumpSize = dumpSize
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+		// Read the rest of the object, so the checksum can still be compared
+		if _, err := io.Copy(io.Discard, stored); err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("failed to read backup: %v", err))
+		}
+	}
+	result.Size = stored.n
+
+	if manifest != nil {
+		checksum := hex.EncodeToString(hash.Sum(nil))
+		if checksum != manifest.SHA256 {
+			result.Problems = append(result.Problems, fmt.Sprintf("checksum mismatch: expected %s, got %s", manifest.SHA256, checksum))
+		}
+		if stored.n != manifest.CompressedSize {
+			result.Problems = append(result.Problems, fmt.Sprintf("size mismatch: expected %d bytes, got %d", manifest.CompressedSize, stored.n))
+		}
+		if tail != nil && dumpSize != manifest.Size {
+			result.Problems = append(result.Problems, fmt.Sprintf("dump size mismatch: expected %d bytes, got %d", manifest.Size, dumpSize))
+		}
+	}
+
+	// Without a decoded dump there is no trailer to look at
+	if tail == nil {
+		if err == nil {
+			result.Warnings = append(result.Warnings, "backup is encrypted and AGE_IDENTITY_FILE is not set, contents not verified")
+		}
+		return result
+	}
+
+	if marker := completionMarker(backup); marker != "" && !bytes.Contains(tail, []byte(marker)) {
+		result.Problems = append(result.Problems, fmt.Sprintf("completion marker %q not found, dump is truncated", marker))
+	}
+
+	return result
+}
+
+// decodeToEnd decrypts and decompresses a stored backup until its end and
+// returns the last bytes of the dump along with the dump size. Decoding
+// checks the framing of compressed and encrypted backups, so truncation is
+// reported as an error. The tail is nil if the backup can't be decrypted
+// because no identity is configured.
+func (s *Service) decodeToEnd(stored io.Reader, key string) ([]byte, int64, error) {
+	if isEncrypted(key) && s.cfg.AgeIdentityFile == "" {
+		// Still read the object, so its checksum can be verified
+		if _, err := io.Copy(io.Discard, stored); err != nil {
+			return nil, 0, fmt.Errorf("failed to read backup: %w", err)
+		}
+		return nil, 0, nil
+	}
+
+	decrypted, err := newDecryptReader(stored, key, s.cfg.AgeIdentityFile)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+
+	decompressed, err := newDecompressReader(decrypted, key)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	defer decompressed.Close()
+
+	tail := &tailWriter{buf: []byte{}, size: tailSize}
+	n, err := io.Copy(tail, decompressed)
+	if err != nil {
+		return nil, n, fmt.Errorf("failed to decode backup: %w", err)
+	}
+
+	return tail.buf, n, nil
+}
+
+// completionMarker returns the text the dump tool writes at the very end of
+// a complete dump, or an empty string if it doesn't write one
+func completionMarker(backup Backup) string {
+	// Only SQL scripts end in a comment, binary formats are checked by decoding
+	if dumpExtension(backup.Key) != ".sql" {
+		return ""
+	}
+
+	switch config.DatabaseType(backup.DBType) {
+	case config.MySQL:
+		return "-- Dump completed"
+	case config.PostgreSQL:
+		return "-- PostgreSQL database dump complete"
+	default:
+		return ""
+	}
+}
+
+// tailWriter keeps the last size bytes written to it
+type tailWriter struct {
+	buf  []byte
+	size int
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.size {
+		w.buf = append(w.buf[:0], w.buf[len(w.buf)-w.size:]...)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/storage"
+)
+
+// storeBackup gzips dump and stores it under key together with a manifest.
+// The stored object is cut to truncate bytes if set.
+func storeBackup(t *testing.T, backend storage.Backend, key, dump string, truncate int) {
+	t.Helper()
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	compressor, _ := newCompressWriter(&buf, config.CompressionGzip, 0)
+	io.WriteString(compressor, dump)
+	compressor.Close()
+
+	sum := sha256.Sum256(buf.Bytes())
+	manifest := Manifest{
+		Key:            key,
+		SHA256:         hex.EncodeToString(sum[:]),
+		Size:           int64(len(dump)),
+		CompressedSize: int64(buf.Len()),
+	}
+
+	stored := buf.Bytes()
+	if truncate > 0 {
+		stored = stored[:truncate]
+	}
+
+	if err := backend.Upload(ctx, key, bytes.NewReader(stored), storage.UploadOptions{}); err != nil {
+		t.Fatalf("Failed to upload %s: %v", key, err)
+	}
+
+	data, _ := json.Marshal(manifest)
+	manifestKey := strings.TrimSuffix(key, ".sql.gz") + manifestExtension
+	if err := backend.Upload(ctx, manifestKey, bytes.NewReader(data), storage.UploadOptions{}); err != nil {
+		t.Fatalf("Failed to upload %s: %v", manifestKey, err)
+	}
+}
+
+// TestVerifyBackups tests detecting intact, truncated and incomplete backups
+func TestVerifyBackups(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	complete := strings.Repeat("INSERT INTO t VALUES (1);\n", 500) + "-- Dump completed on 2024-01-01  0:00:00\n"
+	storeBackup(t, backend, "backup/testdb-mysql-20240101-000000.sql.gz", complete, 0)
+	storeBackup(t, backend, "backup/testdb-mysql-20240102-000000.sql.gz", complete, 100)
+	storeBackup(t, backend, "backup/testdb-mysql-20240103-000000.sql.gz", "INSERT INTO t VALUES (1);\n", 0)
+
+	cfg := &config.Config{
+		DBType:       config.MySQL,
+		DBName:       "testdb",
+		BackupPrefix: "backup",
+	}
+	svc := &Service{cfg: cfg, storage: backend}
+
+	results, err := svc.VerifyBackups(ctx, "", true)
+	if err != nil {
+		t.Fatalf("Failed to verify backups: %v", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	outcomes := make(map[string]VerifyResult)
+	for _, result := range results {
+		outcomes[result.Key] = result
+	}
+
+	if result := outcomes["backup/testdb-mysql-20240101-000000.sql.gz"]; !result.OK() {
+		t.Errorf("Expected complete backup to pass, got %v", result.Problems)
+	}
+
+	if result := outcomes["backup/testdb-mysql-20240102-000000.sql.gz"]; result.OK() {
+		t.Error("Expected truncated backup to fail")
+	}
+
+	if result := outcomes["backup/testdb-mysql-20240103-000000.sql.gz"]; result.OK() {
+		t.Error("Expected backup without completion marker to fail")
+	}
+
+	// Without --all only the latest backup is verified
+	results, err = svc.VerifyBackups(ctx, "", false)
+	if err != nil {
+		t.Fatalf("Failed to verify backups: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Key != "backup/testdb-mysql-20240103-000000.sql.gz" {
+		t.Errorf("Expected only the latest backup to be verified, got %v", results)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/backup"
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+var (
+	// configFile is the path of the YAML config file defining the backup jobs
+	configFile string
+	// jobName restricts commands to a single job from the config file
+	jobName string
+	// databaseName selects a single database of a job backing up all databases
+	databaseName string
+)
+
+// loadJobs loads the configuration of all selected jobs, either from the
+// config file or, when none is given, a single job from environment variables
+func loadJobs() ([]*config.Config, error) {
+	if configFile == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			return nil, err
+		}
+		return []*config.Config{cfg}, nil
+	}
+
+	jobs, err := config.LoadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if jobName == "" {
+		return jobs, nil
+	}
+
+	for _, job := range jobs {
+		if job.Name == jobName {
+			return []*config.Config{job}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("job %s not found in %s", jobName, configFile)
+}
+
+// loadJob loads the configuration of the single job a command operates on
+func loadJob() (*config.Config, error) {
+	jobs, err := loadJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jobs) > 1 {
+		return nil, fmt.Errorf("%s defines %d jobs, select one with --job", configFile, len(jobs))
+	}
+
+	return jobs[0], nil
+}
+
+// selectDatabase narrows a backup service down to the database given with
+// --database, if any
+func selectDatabase(svc *backup.Service) *backup.Service {
+	if databaseName == "" {
+		return svc
+	}
+
+	return svc.ForDatabase(databaseName)
+}
+
+// envOrDefault returns the value of an environment variable, or def when it is unset.
+// An explicitly empty variable is returned as is, so features can be disabled.
+func envOrDefault(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+
+	return def
+}
+
+// durationEnvOrDefault returns the duration in an environment variable, or def
+// when it is unset or empty. An invalid value is reported along with def.
+func durationEnvOrDefault(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid %s value: %w", key, err)
+	}
+
+	return duration, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", os.Getenv("CONFIG_FILE"), "YAML config file defining the backup jobs (env: CONFIG_FILE)")
+	rootCmd.PersistentFlags().StringVar(&jobName, "job", "", "only operate on the named job from the config file")
+}
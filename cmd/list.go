@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/backup"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listDatabase string
+	listSince    string
+	listUntil    string
+	listOutput   string
+)
+
+// listEntry is a backup as printed by the list command
+type listEntry struct {
+	Job        string    `json:"job"`
+	Key        string    `json:"key"`
+	Database   string    `json:"database"`
+	Engine     string    `json:"engine"`
+	Timestamp  time.Time `json:"timestamp"`
+	Size       int64     `json:"size"`
+	AgeSeconds int64     `json:"age_seconds"`
+	KeptBy     []string  `json:"kept_by"`
+	Prune      bool      `json:"prune"`
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored backups",
+	Long: `List the stored backups of each job, newest first.
+
+Each backup is shown with its database, engine, timestamp, size and age, and
+whether the retention policy protects it or it is due for pruning. Backups can
+be filtered by database and by a date range. --since and --until accept a date
+(2024-01-31) or an RFC 3339 time; a date given to --until includes that day.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Abort cleanly on interrupt
+		ctx, stop := interruptContext()
+		defer stop()
+
+		if listOutput != "table" && listOutput != "json" {
+			fmt.Fprintf(os.Stderr, "Error: invalid output format %s, must be 'table' or 'json'\n", listOutput)
+			os.Exit(1)
+		}
+
+		since, err := parseListTime(listSince, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --since value: %v\n", err)
+			os.Exit(1)
+		}
+
+		until, err := parseListTime(listUntil, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --until value: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Load configuration
+		jobs, err := loadJobs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		now := time.Now().UTC()
+		entries := []listEntry{}
+		for _, cfg := range jobs {
+			// Initialize backup service
+			backupSvc, err := backup.NewService(cfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error initializing backup service for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
+
+			backups, err := backupSvc.ListBackups(ctx, false)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing backups for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
+
+			for _, b := range backups {
+				if listDatabase != "" && b.DBName != listDatabase {
+					continue
+				}
+				if !since.IsZero() && b.Timestamp.Before(since) {
+					continue
+				}
+				if !until.IsZero() && !b.Timestamp.Before(until) {
+					continue
+				}
+
+				keptBy := b.KeptBy
+				if keptBy == nil {
+					keptBy = []string{} // Encode as an empty list rather than null
+				}
+
+				entries = append(entries, listEntry{
+					Job:        cfg.Name,
+					Key:        b.Key,
+					Database:   b.DBName,
+					Engine:     b.DBType,
+					Timestamp:  b.Timestamp,
+					Size:       b.Size,
+					AgeSeconds: int64(now.Sub(b.Timestamp).Seconds()),
+					KeptBy:     keptBy,
+					Prune:      len(b.KeptBy) == 0,
+				})
+			}
+		}
+
+		if listOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(entries); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding backups: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tDATABASE\tENGINE\tTIMESTAMP\tSIZE\tAGE\tRETENTION")
+		for _, entry := range entries {
+			retention := "prune"
+			if !entry.Prune {
+				retention = "keep (" + strings.Join(entry.KeptBy, ", ") + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.Key,
+				entry.Database,
+				entry.Engine,
+				entry.Timestamp.Format(time.RFC3339),
+				formatSize(entry.Size),
+				formatAge(time.Duration(entry.AgeSeconds)*time.Second),
+				retention,
+			)
+		}
+		w.Flush()
+	},
+}
+
+// parseListTime parses a --since or --until value. With endOfDay set, a plain
+// date refers to the end of that day, so the day is included in the range.
+func parseListTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither a date nor an RFC 3339 time", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// formatSize formats a size in bytes for humans
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// formatAge formats the age of a backup in its two largest units
+func formatAge(age time.Duration) string {
+	days := int(age.Hours()) / 24
+	hours := int(age.Hours()) % 24
+	minutes := int(age.Minutes()) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringVar(&listDatabase, "database", "", "only list backups of this database")
+	listCmd.Flags().StringVar(&listSince, "since", "", "only list backups taken at or after this date or time")
+	listCmd.Flags().StringVar(&listUntil, "until", "", "only list backups taken before this time, or on or before this date")
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "table", "output format, 'table' or 'json'")
+}
@@ -1,67 +1,188 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/nilsmarti/go-dbdumper/backup"
-	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/metrics"
 	"github.com/nilsmarti/go-dbdumper/scheduler"
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "go-dbdumper",
-	Short: "A tool to backup databases to S3",
-	Long: `go-dbdumper is a tool that creates database dumps and uploads them directly to S3 compatible storage.
+	Short: "A tool to backup databases to S3 compatible or local storage",
+	Long: `go-dbdumper is a tool that creates database dumps and uploads them directly to S3 compatible or local storage.
 
-It supports both MySQL and PostgreSQL databases and can be configured via environment variables.`,
+It supports MySQL, PostgreSQL, MongoDB, SQLite and Redis databases and can be configured via environment variables
+or a YAML config file defining several backup jobs.`,
 }
 
+var (
+	metricsAddr string
+	gracePeriod time.Duration
+	// gracePeriodErr reports an invalid SHUTDOWN_GRACE_PERIOD
+	gracePeriodErr error
+)
+
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the backup scheduler",
-	Long:  `Run the backup scheduler which will perform backups according to the configured cron schedule.`,
+	Long: `Run the backup scheduler which will perform backups according to the configured cron schedule.
+
+When a config file is given, all of its jobs are scheduled in this process.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Load configuration
-		cfg, err := config.Load()
+		jobs, err := loadJobs()
 		if err != nil {
 			fmt.Printf("Error loading configuration: %v\n", err)
 			os.Exit(1)
 		}
 
-		// Initialize backup service
-		backupSvc, err := backup.NewService(cfg)
-		if err != nil {
-			fmt.Printf("Error initializing backup service: %v\n", err)
+		if gracePeriodErr != nil {
+			fmt.Printf("Error loading configuration: %v\n", gracePeriodErr)
 			os.Exit(1)
 		}
 
-		// Initialize scheduler
-		scheduler := scheduler.New(cfg.CronExpression, backupSvc.PerformBackup)
+		var schedulers []*scheduler.Scheduler
+		for _, cfg := range jobs {
+			// Initialize backup service
+			backupSvc, err := backup.NewService(cfg)
+			if err != nil {
+				fmt.Printf("Error initializing backup service for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
 
-		// Start the scheduler
-		if err := scheduler.Start(); err != nil {
-			fmt.Printf("Error starting scheduler: %v\n", err)
-			os.Exit(1)
+			// Initialize scheduler
+			scheduler := scheduler.New(cfg.Name, cfg.CronExpression, cfg.OverlapPolicy, backupSvc.PerformBackup)
+
+			// Start the scheduler
+			if err := scheduler.Start(); err != nil {
+				fmt.Printf("Error starting scheduler for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
+			schedulers = append(schedulers, scheduler)
+
+			fmt.Printf("Scheduled job %s with cron expression: %s\n", cfg.Name, cfg.CronExpression)
+		}
+
+		// Expose metrics while the scheduler is running
+		var server *http.Server
+		if metricsAddr != "" {
+			server = metrics.NewServer(metricsAddr)
+			go func() {
+				if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					fmt.Printf("Error serving metrics: %v\n", err)
+				}
+			}()
+			fmt.Printf("Serving metrics on %s/metrics\n", metricsAddr)
 		}
-		defer scheduler.Stop()
 
-		fmt.Printf("DB Dumper started with cron expression: %s\n", cfg.CronExpression)
+		fmt.Printf("DB Dumper started with %d job(s)\n", len(jobs))
 		fmt.Println("Press Ctrl+C to exit.")
 
 		// Wait for interrupt signal
-		select {}
+		ctx, stop := interruptContext()
+		<-ctx.Done()
+		stop()
+
+		fmt.Printf("Shutting down, waiting up to %s for running backups\n", gracePeriod)
+
+		// Give running backups the grace period to finish, then abort them
+		var wg sync.WaitGroup
+		for _, scheduler := range schedulers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if !scheduler.Shutdown(gracePeriod) {
+					fmt.Println("Aborted a running backup after the grace period")
+				}
+			}()
+		}
+		wg.Wait()
+
+		if server != nil {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}
+
+		fmt.Println("DB Dumper stopped.")
 	},
 }
 
 var backupNowCmd = &cobra.Command{
 	Use:   "backup-now",
 	Short: "Run a backup immediately",
-	Long:  `Run a backup immediately without waiting for the scheduled time.`,
+	Long: `Run a backup immediately without waiting for the scheduled time.
+
+When a config file is given, all of its jobs are backed up unless --job selects one.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		// Abort cleanly on interrupt
+		ctx, stop := interruptContext()
+		defer stop()
+
 		// Load configuration
-		cfg, err := config.Load()
+		jobs, err := loadJobs()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		failed := 0
+		for _, cfg := range jobs {
+			// Initialize backup service
+			backupSvc, err := backup.NewService(cfg)
+			if err != nil {
+				fmt.Printf("Error initializing backup service for job %s: %v\n", cfg.Name, err)
+				failed++
+				continue
+			}
+
+			// Perform backup
+			if err := backupSvc.PerformBackup(ctx); err != nil {
+				fmt.Printf("Error performing backup for job %s: %v\n", cfg.Name, err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			fmt.Printf("%d of %d backup(s) failed.\n", failed, len(jobs))
+			os.Exit(1)
+		}
+
+		fmt.Println("Backup completed successfully.")
+	},
+}
+
+var restoreGlobals bool
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [key|timestamp]",
+	Short: "Restore a backup into the database",
+	Long: `Restore a backup from storage into the configured database.
+
+By default the latest backup is restored. A specific backup can be selected by
+passing its full object key or its timestamp (e.g. 20240101-000000).
+
+For PostgreSQL backups taken with PG_DUMP_GLOBALS, --globals first loads the
+roles and tablespaces stored with the backup.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Abort cleanly on interrupt
+		ctx, stop := interruptContext()
+		defer stop()
+
+		// Load configuration
+		cfg, err := loadJob()
 		if err != nil {
 			fmt.Printf("Error loading configuration: %v\n", err)
 			os.Exit(1)
@@ -73,17 +194,222 @@ var backupNowCmd = &cobra.Command{
 			fmt.Printf("Error initializing backup service: %v\n", err)
 			os.Exit(1)
 		}
+		backupSvc = selectDatabase(backupSvc)
+
+		var ref string
+		if len(args) > 0 {
+			ref = args[0]
+		}
+
+		// Create the roles before the objects owned by them
+		if restoreGlobals {
+			if err := backupSvc.RestoreGlobals(ctx, ref); err != nil {
+				fmt.Printf("Error restoring globals: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
-		// Perform backup
-		if err := backupSvc.PerformBackup(); err != nil {
-			fmt.Printf("Error performing backup: %v\n", err)
+		// Perform restore
+		if err := backupSvc.PerformRestore(ctx, ref); err != nil {
+			fmt.Printf("Error performing restore: %v\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Println("Backup completed successfully.")
+		fmt.Println("Restore completed successfully.")
+	},
+}
+
+var downloadOutput string
+
+var downloadCmd = &cobra.Command{
+	Use:   "download [key|timestamp]",
+	Short: "Download a decrypted and decompressed backup",
+	Long: `Download a backup and write the plain dump to a file or stdout.
+
+Encrypted backups are decrypted with the identities in AGE_IDENTITY_FILE and
+compressed backups are decompressed. By default the latest backup is downloaded.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Abort cleanly on interrupt
+		ctx, stop := interruptContext()
+		defer stop()
+
+		// Load configuration
+		cfg, err := loadJob()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Initialize backup service
+		backupSvc, err := backup.NewService(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing backup service: %v\n", err)
+			os.Exit(1)
+		}
+		backupSvc = selectDatabase(backupSvc)
+
+		var ref string
+		if len(args) > 0 {
+			ref = args[0]
+		}
+
+		// Write to stdout unless an output file is given. Files are written
+		// next to the output and renamed once complete, so a failed download
+		// leaves no partial dump behind.
+		out := os.Stdout
+		toFile := downloadOutput != "" && downloadOutput != "-"
+		if toFile {
+			out, err = os.CreateTemp(filepath.Dir(downloadOutput), "."+filepath.Base(downloadOutput)+".*")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		objName, err := backupSvc.DownloadBackup(ctx, ref, out)
+		if toFile {
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(out.Name(), downloadOutput)
+			}
+			if err != nil {
+				os.Remove(out.Name())
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error downloading backup: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Downloaded %s\n", objName)
 	},
 }
 
+var verifyAll bool
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [key|timestamp]",
+	Short: "Verify the integrity of backups",
+	Long: `Verify backups by streaming them from storage.
+
+The checksum is recomputed and compared with the backup's manifest, compressed
+and encrypted backups are decoded to the end, and the dump is checked for the
+dump tool's completion marker. By default the latest backup is verified, use
+--all to verify every backup. Exits non-zero if any backup fails verification.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Abort cleanly on interrupt
+		ctx, stop := interruptContext()
+		defer stop()
+
+		// Load configuration
+		jobs, err := loadJobs()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		var ref string
+		if len(args) > 0 {
+			ref = args[0]
+		}
+
+		failed := 0
+		for _, cfg := range jobs {
+			// Initialize backup service
+			backupSvc, err := backup.NewService(cfg)
+			if err != nil {
+				fmt.Printf("Error initializing backup service for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
+			backupSvc = selectDatabase(backupSvc)
+
+			// Verify backups
+			results, err := backupSvc.VerifyBackups(ctx, ref, verifyAll)
+			for _, result := range results {
+				if result.OK() {
+					fmt.Printf("OK    %s (%d bytes stored, %d bytes dump)\n", result.Key, result.Size, result.DumpSize)
+				} else {
+					failed++
+					fmt.Printf("FAIL  %s\n", result.Key)
+				}
+				for _, problem := range result.Problems {
+					fmt.Printf("      error: %s\n", problem)
+				}
+				for _, warning := range result.Warnings {
+					fmt.Printf("      warning: %s\n", warning)
+				}
+			}
+			if err != nil {
+				fmt.Printf("Error verifying backups for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
+		}
+
+		if failed > 0 {
+			fmt.Printf("%d backup(s) failed verification.\n", failed)
+			os.Exit(1)
+		}
+
+		fmt.Println("All backups verified successfully.")
+	},
+}
+
+var pruneDryRun bool
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove backups according to the retention policy",
+	Long: `Apply the configured retention policy without performing a backup.
+
+Every backup that isn't kept by any KEEP_* rule is removed together with its
+companion objects. Use --dry-run to print which backups would be removed and
+which rules keep the others, without deleting anything.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Abort cleanly on interrupt
+		ctx, stop := interruptContext()
+		defer stop()
+
+		// Load configuration
+		jobs, err := loadJobs()
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		for _, cfg := range jobs {
+			// Initialize backup service
+			backupSvc, err := backup.NewService(cfg)
+			if err != nil {
+				fmt.Printf("Error initializing backup service for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
+
+			// Prune backups
+			if err := backupSvc.Prune(ctx, pruneDryRun); err != nil {
+				fmt.Printf("Error pruning backups for job %s: %v\n", cfg.Name, err)
+				os.Exit(1)
+			}
+		}
+
+		if pruneDryRun {
+			fmt.Println("Dry run completed, no backups were removed.")
+			return
+		}
+
+		fmt.Println("Pruning completed successfully.")
+	},
+}
+
+// interruptContext returns a context that is cancelled on SIGINT or SIGTERM
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
 // Execute executes the root command
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -93,6 +419,25 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.Version = backup.Version
+
 	rootCmd.AddCommand(runCmd)
+
+	var gracePeriodDefault time.Duration
+	gracePeriodDefault, gracePeriodErr = durationEnvOrDefault("SHUTDOWN_GRACE_PERIOD", 20*time.Second)
+	runCmd.Flags().DurationVar(&gracePeriod, "grace-period", gracePeriodDefault, "time running backups get to finish on shutdown before they are aborted (env: SHUTDOWN_GRACE_PERIOD)")
+	runCmd.Flags().StringVar(&metricsAddr, "metrics-addr", envOrDefault("METRICS_ADDR", ":9090"), "address to serve Prometheus metrics on, empty to disable (env: METRICS_ADDR)")
 	rootCmd.AddCommand(backupNowCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(downloadCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(pruneCmd)
+
+	for _, cmd := range []*cobra.Command{restoreCmd, downloadCmd, verifyCmd} {
+		cmd.Flags().StringVar(&databaseName, "database", "", "database to operate on when the job backs up all databases")
+	}
+	restoreCmd.Flags().BoolVar(&restoreGlobals, "globals", false, "restore the PostgreSQL roles and tablespaces stored with the backup first")
+	downloadCmd.Flags().StringVarP(&downloadOutput, "output", "o", "", "file to write the dump to (default stdout)")
+	verifyCmd.Flags().BoolVar(&verifyAll, "all", false, "verify all backups instead of a single one")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "only print which backups would be removed")
 }
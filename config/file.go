@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of a YAML config file. Settings use the names of
+// their environment variables in lower case, e.g. db_host or keep_last.
+type fileConfig struct {
+	// Defaults apply to every job that doesn't override them
+	Defaults map[string]interface{}   `yaml:"defaults"`
+	Jobs     []map[string]interface{} `yaml:"jobs"`
+}
+
+// LoadFile loads the job configurations defined in a YAML config file.
+// Settings missing from a job fall back to the file's defaults and then to
+// environment variables, so secrets can still be passed through the environment.
+func LoadFile(path string) ([]*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file fileConfig
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if len(file.Jobs) == 0 {
+		return nil, errors.New("config file must define at least one job")
+	}
+
+	defaults, err := settings(file.Defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid defaults: %w", err)
+	}
+
+	var jobs []*Config
+	names := make(map[string]bool)
+	for i, job := range file.Jobs {
+		values, err := settings(job)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job %d: %w", i+1, err)
+		}
+
+		name := values["NAME"]
+		if name == "" {
+			return nil, fmt.Errorf("job %d has no name", i+1)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate job name: %s", name)
+		}
+		names[name] = true
+		delete(values, "NAME")
+		values["JOB_NAME"] = name
+
+		// Track which settings are read to catch misspelled keys
+		used := make(map[string]bool)
+		cfg, err := load(func(key string) string {
+			used[key] = true
+			if value, ok := values[key]; ok {
+				return value
+			}
+			if value, ok := defaults[key]; ok {
+				return value
+			}
+			// A secret set in the file replaces its counterpart in the
+			// environment, as both can't be set
+			counterpart := key + "_FILE"
+			if name, ok := strings.CutSuffix(key, "_FILE"); ok {
+				counterpart = name
+			}
+			if _, ok := values[counterpart]; ok {
+				return ""
+			}
+			if _, ok := defaults[counterpart]; ok {
+				return ""
+			}
+			return os.Getenv(key)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", name, err)
+		}
+
+		for _, key := range sortedKeys(values, defaults) {
+			if !used[key] {
+				return nil, fmt.Errorf("job %s: unknown setting %s", name, strings.ToLower(key))
+			}
+		}
+
+		jobs = append(jobs, cfg)
+	}
+
+	return jobs, nil
+}
+
+// settings converts YAML values to strings keyed by environment variable name.
+// Lists are joined with commas.
+func settings(values map[string]interface{}) (map[string]string, error) {
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		switch v := value.(type) {
+		case nil:
+			result[strings.ToUpper(key)] = ""
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			result[strings.ToUpper(key)] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("setting %s must not be a map", key)
+		default:
+			result[strings.ToUpper(key)] = fmt.Sprint(v)
+		}
+	}
+
+	return result, nil
+}
+
+// sortedKeys returns the keys of all maps in a stable order
+func sortedKeys(maps ...map[string]string) []string {
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
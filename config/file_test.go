@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfigFile writes a config file to a temporary directory and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "dumper.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	// Secrets can still come from the environment
+	t.Setenv("S3_SECRET_KEY", "secretkey")
+	t.Setenv("KEEP_LAST", "")
+
+	path := writeConfigFile(t, `
+defaults:
+  s3_endpoint: minio:9000
+  s3_bucket: backups
+  s3_access_key: accesskey
+  keep_last: 7
+jobs:
+  - name: shop
+    db_type: mysql
+    db_host: mysql.internal
+    db_name: shop
+    db_user: shop
+    db_password: password
+    cron_expression: "0 1 * * *"
+    backup_prefix: shop
+  - name: crm
+    db_type: postgres
+    db_host: pg.internal
+    db_name: crm
+    db_user: crm
+    db_password: password
+    keep_last: 14
+    storage_type: local
+    storage_path: /mnt/backups
+    age_recipients:
+      - age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+`)
+
+	jobs, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs, got %d", len(jobs))
+	}
+
+	shop, crm := jobs[0], jobs[1]
+
+	if shop.Name != "shop" || crm.Name != "crm" {
+		t.Errorf("Expected jobs shop and crm, got %s and %s", shop.Name, crm.Name)
+	}
+
+	if shop.DBPort != "3306" || crm.DBPort != "5432" {
+		t.Errorf("Expected default ports 3306 and 5432, got %s and %s", shop.DBPort, crm.DBPort)
+	}
+
+	if shop.CronExpression != "0 1 * * *" {
+		t.Errorf("Expected CronExpression to be '0 1 * * *', got %s", shop.CronExpression)
+	}
+
+	if shop.KeepLast != 7 {
+		t.Errorf("Expected KeepLast from defaults to be 7, got %d", shop.KeepLast)
+	}
+
+	if crm.KeepLast != 14 {
+		t.Errorf("Expected KeepLast to be 14, got %d", crm.KeepLast)
+	}
+
+	if shop.S3SecretKey != "secretkey" {
+		t.Errorf("Expected S3SecretKey from environment to be secretkey, got %s", shop.S3SecretKey)
+	}
+
+	if crm.StorageType != StorageLocal || crm.StoragePath != "/mnt/backups" {
+		t.Errorf("Expected local storage in /mnt/backups, got %s in %s", crm.StorageType, crm.StoragePath)
+	}
+
+	if len(crm.AgeRecipients) != 1 {
+		t.Errorf("Expected 1 age recipient, got %d", len(crm.AgeRecipients))
+	}
+}
+
+// TestLoadFileSecretFiles tests that secrets in the file replace those in the environment
+func TestLoadFileSecretFiles(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "envpassword")
+	t.Setenv("S3_SECRET_KEY_FILE", "/run/secrets/missing")
+	t.Setenv("KEEP_LAST", "")
+
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "db_password")
+	if err := os.WriteFile(passwordFile, []byte("filepassword\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	path := writeConfigFile(t, `
+defaults:
+  s3_endpoint: minio:9000
+  s3_bucket: backups
+  s3_access_key: accesskey
+  s3_secret_key: secretkey
+jobs:
+  - name: shop
+    db_type: mysql
+    db_host: mysql.internal
+    db_name: shop
+    db_user: shop
+    db_password_file: `+passwordFile+`
+`)
+
+	jobs, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+
+	if jobs[0].DBPassword != "filepassword" {
+		t.Errorf("Expected DBPassword to be 'filepassword', got '%s'", jobs[0].DBPassword)
+	}
+	if jobs[0].S3SecretKey != "secretkey" {
+		t.Errorf("Expected S3SecretKey to be 'secretkey', got '%s'", jobs[0].S3SecretKey)
+	}
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no jobs", "jobs: []\n"},
+		{"missing name", `
+jobs:
+  - db_host: localhost
+`},
+		{"duplicate name", `
+defaults:
+  db_host: localhost
+  db_name: testdb
+  db_user: user
+  db_password: password
+  storage_type: local
+  storage_path: /backups
+jobs:
+  - name: app
+  - name: app
+`},
+		{"unknown setting", `
+jobs:
+  - name: app
+    db_host: localhost
+    db_name: testdb
+    db_user: user
+    db_password: password
+    storage_type: local
+    storage_path: /backups
+    keep_lsat: 3
+`},
+	}
+
+	t.Setenv("KEEP_LAST", "")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadFile(writeConfigFile(t, tt.content)); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
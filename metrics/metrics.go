@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dbdumper"
+
+var (
+	backupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backups_total",
+		Help:      "Number of backup runs by result.",
+	}, []string{"backup_job", "result"})
+
+	lastSuccessTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful backup.",
+	}, []string{"backup_job"})
+
+	lastDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_duration_seconds",
+		Help:      "Duration of the last backup run.",
+	}, []string{"backup_job"})
+
+	lastSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_size_bytes",
+		Help:      "Stored size of the last successful backup.",
+	}, []string{"backup_job"})
+
+	skippedRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "skipped_runs_total",
+		Help:      "Number of backup runs skipped because the previous backup was still running.",
+	}, []string{"backup_job"})
+
+	retentionDeletionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_deletions_total",
+		Help:      "Number of backups removed by the retention policy.",
+	}, []string{"backup_job"})
+)
+
+// RegisterJob initializes the counters of a job, so they are reported as zero
+// before its first run
+func RegisterJob(job string) {
+	backupsTotal.WithLabelValues(job, "success")
+	backupsTotal.WithLabelValues(job, "failure")
+	skippedRunsTotal.WithLabelValues(job)
+	retentionDeletionsTotal.WithLabelValues(job)
+}
+
+// ObserveBackup records the outcome of a backup run
+func ObserveBackup(job string, duration time.Duration, size int64, err error) {
+	lastDuration.WithLabelValues(job).Set(duration.Seconds())
+
+	if err != nil {
+		backupsTotal.WithLabelValues(job, "failure").Inc()
+		return
+	}
+
+	backupsTotal.WithLabelValues(job, "success").Inc()
+	lastSuccessTimestamp.WithLabelValues(job).SetToCurrentTime()
+	lastSize.WithLabelValues(job).Set(float64(size))
+}
+
+// ObserveSkippedRun records a backup run skipped because of an overlap
+func ObserveSkippedRun(job string) {
+	skippedRunsTotal.WithLabelValues(job).Inc()
+}
+
+// ObserveRetentionDeletion records a backup removed by the retention policy
+func ObserveRetentionDeletion(job string) {
+	retentionDeletionsTotal.WithLabelValues(job).Inc()
+}
+
+// NewServer creates an HTTP server exposing the metrics on /metrics
+func NewServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveBackup(t *testing.T) {
+	RegisterJob("test")
+
+	// A successful run updates all per-job metrics
+	ObserveBackup("test", 2*time.Second, 1024, nil)
+
+	if v := testutil.ToFloat64(backupsTotal.WithLabelValues("test", "success")); v != 1 {
+		t.Errorf("Expected 1 successful backup, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(lastDuration.WithLabelValues("test")); v != 2 {
+		t.Errorf("Expected last duration to be 2, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(lastSize.WithLabelValues("test")); v != 1024 {
+		t.Errorf("Expected last size to be 1024, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(lastSuccessTimestamp.WithLabelValues("test")); v < float64(time.Now().Add(-time.Minute).Unix()) {
+		t.Errorf("Expected last success timestamp to be recent, got %v", v)
+	}
+
+	// A failed run must not touch the last success
+	lastSuccess := testutil.ToFloat64(lastSuccessTimestamp.WithLabelValues("test"))
+	ObserveBackup("test", time.Second, 0, errors.New("dump failed"))
+
+	if v := testutil.ToFloat64(backupsTotal.WithLabelValues("test", "failure")); v != 1 {
+		t.Errorf("Expected 1 failed backup, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(lastSize.WithLabelValues("test")); v != 1024 {
+		t.Errorf("Expected last size to stay 1024, got %v", v)
+	}
+
+	if v := testutil.ToFloat64(lastSuccessTimestamp.WithLabelValues("test")); v != lastSuccess {
+		t.Errorf("Expected last success timestamp to stay %v, got %v", lastSuccess, v)
+	}
+
+	ObserveRetentionDeletion("test")
+	ObserveRetentionDeletion("test")
+
+	if v := testutil.ToFloat64(retentionDeletionsTotal.WithLabelValues("test")); v != 2 {
+		t.Errorf("Expected 2 retention deletions, got %v", v)
+	}
+}
+
+func TestServer(t *testing.T) {
+	RegisterJob("served")
+
+	server := NewServer(":0")
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if recorder.Code != 200 {
+		t.Fatalf("Expected status 200, got %d", recorder.Code)
+	}
+
+	if !strings.Contains(recorder.Body.String(), `dbdumper_backups_total{backup_job="served",result="failure"} 0`) {
+		t.Error("Expected registered job to be reported with zero failures")
+	}
+}
@@ -1,33 +1,65 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/nilsmarti/go-dbdumper/config"
+	"github.com/nilsmarti/go-dbdumper/metrics"
 	"github.com/robfig/cron/v3"
 )
 
+// ErrSkipped is returned when a backup is skipped because another one is still running
+var ErrSkipped = errors.New("backup skipped, previous backup is still running")
+
+// ErrShutdown is returned when a backup is triggered after Shutdown has been called
+var ErrShutdown = errors.New("scheduler is shut down")
+
 // Scheduler handles scheduling of backup tasks
 type Scheduler struct {
-	cron        *cron.Cron
-	expression  string
-	backupFunc  func() error
-	entryID     cron.EntryID
-	running     bool
-	mutex       sync.Mutex
+	cron       *cron.Cron
+	name       string
+	expression string
+	policy     config.OverlapPolicy
+	backupFunc func(ctx context.Context) error
+	entryID    cron.EntryID
+	running    bool
+	mutex      sync.Mutex
+
+	// backupMutex is held while a backup runs, so runs never overlap
+	backupMutex sync.Mutex
+	// queued is set while a run waits for the running backup with the queue policy
+	queued bool
+
+	// ctx is passed to every backup run and cancelled on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	// runs tracks backups that are currently in progress
+	runs sync.WaitGroup
+	// closed is set once Shutdown has been called
+	closed bool
 }
 
-// New creates a new scheduler
-func New(cronExpression string, backupFunc func() error) *Scheduler {
+// New creates a new scheduler for the named job. The policy decides what
+// happens when a backup is triggered while the previous one is still running.
+func New(name, cronExpression string, policy config.OverlapPolicy, backupFunc func(ctx context.Context) error) *Scheduler {
 	// Create a new cron scheduler with standard cron format (5 fields)
 	c := cron.New()
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Scheduler{
 		cron:       c,
+		name:       name,
 		expression: cronExpression,
+		policy:     policy,
 		backupFunc: backupFunc,
 		running:    false,
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
@@ -42,13 +74,15 @@ func (s *Scheduler) Start() error {
 
 	// Add the backup function to the cron scheduler
 	entryID, err := s.cron.AddFunc(s.expression, func() {
-		fmt.Printf("Scheduled backup triggered at %s\n", time.Now().Format(time.RFC3339))
-		
+		fmt.Printf("Scheduled backup of job %s triggered at %s\n", s.name, time.Now().Format(time.RFC3339))
+
 		// Execute the backup function
-		if err := s.backupFunc(); err != nil {
-			fmt.Printf("Scheduled backup failed: %v\n", err)
+		if err := s.run(); errors.Is(err, ErrSkipped) {
+			fmt.Printf("Scheduled backup of job %s skipped: previous backup is still running\n", s.name)
+		} else if err != nil {
+			fmt.Printf("Scheduled backup of job %s failed: %v\n", s.name, err)
 		} else {
-			fmt.Printf("Scheduled backup completed successfully at %s\n", time.Now().Format(time.RFC3339))
+			fmt.Printf("Scheduled backup of job %s completed successfully at %s\n", s.name, time.Now().Format(time.RFC3339))
 		}
 	})
 
@@ -64,7 +98,7 @@ func (s *Scheduler) Start() error {
 	return nil
 }
 
-// Stop stops the scheduler
+// Stop stops the scheduler. Backups that are already running are not interrupted.
 func (s *Scheduler) Stop() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -81,15 +115,109 @@ func (s *Scheduler) Stop() {
 	s.running = false
 }
 
-// RunNow executes a backup immediately
+// Shutdown stops scheduling new backups and waits up to gracePeriod for a
+// running backup to finish. After that the backup's context is cancelled, and
+// Shutdown waits for it to clean up and return. It reports whether the running
+// backup finished within the grace period.
+func (s *Scheduler) Shutdown(gracePeriod time.Duration) bool {
+	s.Stop()
+
+	// Refuse new runs, so nothing is added while waiting below
+	s.mutex.Lock()
+	s.closed = true
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		s.cancel()
+		return true
+	case <-timer.C:
+		// Abort the running backup and wait for it to clean up
+		s.cancel()
+		<-done
+		return false
+	}
+}
+
+// RunNow executes a backup immediately. It follows the overlap policy like
+// scheduled runs, so with the skip policy it returns ErrSkipped while another
+// backup is running.
 func (s *Scheduler) RunNow() error {
-	fmt.Printf("Manual backup triggered at %s\n", time.Now().Format(time.RFC3339))
-	
+	fmt.Printf("Manual backup of job %s triggered at %s\n", s.name, time.Now().Format(time.RFC3339))
+
 	// Execute the backup function
-	if err := s.backupFunc(); err != nil {
+	if err := s.run(); err != nil {
 		return fmt.Errorf("manual backup failed: %w", err)
 	}
 
-	fmt.Printf("Manual backup completed successfully at %s\n", time.Now().Format(time.RFC3339))
+	fmt.Printf("Manual backup of job %s completed successfully at %s\n", s.name, time.Now().Format(time.RFC3339))
 	return nil
 }
+
+// run executes the backup function while tracking it as in progress.
+// Overlapping runs are handled according to the overlap policy.
+func (s *Scheduler) run() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return ErrShutdown
+	}
+	s.runs.Add(1)
+	s.mutex.Unlock()
+	defer s.runs.Done()
+
+	if !s.backupMutex.TryLock() {
+		if err := s.waitForRunningBackup(); err != nil {
+			metrics.ObserveSkippedRun(s.name)
+			return err
+		}
+	}
+	defer s.backupMutex.Unlock()
+
+	// Don't start a backup that waited for the running one while shutting down
+	s.mutex.Lock()
+	closed := s.closed
+	s.mutex.Unlock()
+	if closed {
+		return ErrShutdown
+	}
+
+	return s.backupFunc(s.ctx)
+}
+
+// waitForRunningBackup acquires backupMutex while another backup holds it,
+// or returns ErrSkipped if the overlap policy says to skip this run
+func (s *Scheduler) waitForRunningBackup() error {
+	switch s.policy {
+	case config.OverlapDelay:
+		s.backupMutex.Lock()
+		return nil
+	case config.OverlapQueue:
+		// Only a single run waits, further triggers are folded into it
+		s.mutex.Lock()
+		if s.queued {
+			s.mutex.Unlock()
+			return ErrSkipped
+		}
+		s.queued = true
+		s.mutex.Unlock()
+
+		s.backupMutex.Lock()
+
+		s.mutex.Lock()
+		s.queued = false
+		s.mutex.Unlock()
+		return nil
+	default:
+		return ErrSkipped
+	}
+}
@@ -1,8 +1,13 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
 )
 
 func TestScheduler(t *testing.T) {
@@ -11,7 +16,7 @@ func TestScheduler(t *testing.T) {
 	var mu sync.Mutex
 
 	// Create a test backup function
-	backupFunc := func() error {
+	backupFunc := func(ctx context.Context) error {
 		mu.Lock()
 		defer mu.Unlock()
 		counter++
@@ -19,7 +24,7 @@ func TestScheduler(t *testing.T) {
 	}
 
 	// Create a scheduler with a cron expression that runs every minute
-	s := New("* * * * *", backupFunc)
+	s := New("test", "* * * * *", config.OverlapSkip, backupFunc)
 
 	// Start the scheduler
 	err := s.Start()
@@ -49,13 +54,13 @@ func TestRunNow(t *testing.T) {
 	var counter int
 
 	// Create a test backup function
-	backupFunc := func() error {
+	backupFunc := func(ctx context.Context) error {
 		counter++
 		return nil
 	}
 
 	// Create a scheduler with a cron expression that never runs
-	s := New("0 0 31 2 *", backupFunc) // February 31st (never happens)
+	s := New("test", "0 0 31 2 *", config.OverlapSkip, backupFunc) // February 31st (never happens)
 
 	// Run the backup immediately
 	err := s.RunNow()
@@ -68,3 +73,198 @@ func TestRunNow(t *testing.T) {
 		t.Errorf("Expected backup function to be called exactly once, got %d", counter)
 	}
 }
+
+func TestShutdownWaitsForRunningBackup(t *testing.T) {
+	finished := make(chan struct{})
+
+	// Create a backup function that takes a moment to complete
+	backupFunc := func(ctx context.Context) error {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			close(finished)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s := New("test", "0 0 31 2 *", config.OverlapSkip, backupFunc)
+
+	started := make(chan error)
+	go func() {
+		started <- s.RunNow()
+	}()
+
+	// Give the backup a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	if !s.Shutdown(time.Second) {
+		t.Error("Expected backup to finish within the grace period")
+	}
+
+	select {
+	case <-finished:
+	default:
+		t.Error("Expected backup to have finished after Shutdown returned")
+	}
+
+	if err := <-started; err != nil {
+		t.Errorf("Expected backup to succeed, got %v", err)
+	}
+
+	// No new backups are started after shutdown
+	if err := s.RunNow(); err == nil {
+		t.Error("Expected error for backup after shutdown, got nil")
+	}
+}
+
+func TestShutdownAbortsBackupAfterGracePeriod(t *testing.T) {
+	// Create a backup function that only returns once it is cancelled
+	backupFunc := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	s := New("test", "0 0 31 2 *", config.OverlapSkip, backupFunc)
+
+	result := make(chan error)
+	go func() {
+		result <- s.RunNow()
+	}()
+
+	// Give the backup a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	if s.Shutdown(20 * time.Millisecond) {
+		t.Error("Expected backup to be aborted after the grace period")
+	}
+
+	if err := <-result; err == nil {
+		t.Error("Expected aborted backup to return an error, got nil")
+	}
+}
+
+func TestShutdownDropsWaitingRun(t *testing.T) {
+	for _, policy := range []config.OverlapPolicy{config.OverlapQueue, config.OverlapDelay} {
+		t.Run(string(policy), func(t *testing.T) {
+			var counter int
+			var mu sync.Mutex
+			release := make(chan struct{})
+			started := make(chan struct{}, 2)
+
+			// Create a backup function that blocks until released
+			backupFunc := func(ctx context.Context) error {
+				mu.Lock()
+				counter++
+				mu.Unlock()
+				started <- struct{}{}
+				<-release
+				return nil
+			}
+
+			s := New("test", "0 0 31 2 *", policy, backupFunc)
+
+			first := make(chan error, 1)
+			go func() {
+				first <- s.RunNow()
+			}()
+			<-started
+
+			// Trigger a second backup that waits for the first one
+			second := make(chan error, 1)
+			go func() {
+				second <- s.RunNow()
+			}()
+			time.Sleep(20 * time.Millisecond)
+
+			shutdown := make(chan bool)
+			go func() {
+				shutdown <- s.Shutdown(time.Second)
+			}()
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+
+			if !<-shutdown {
+				t.Error("Expected backup to finish within the grace period")
+			}
+			if err := <-first; err != nil {
+				t.Errorf("Expected running backup to succeed, got %v", err)
+			}
+			if err := <-second; !errors.Is(err, ErrShutdown) {
+				t.Errorf("Expected waiting backup to fail with ErrShutdown, got %v", err)
+			}
+
+			if counter != 1 {
+				t.Errorf("Expected backup function to be called once, got %d", counter)
+			}
+		})
+	}
+}
+
+func TestOverlapPolicies(t *testing.T) {
+	tests := []struct {
+		policy   config.OverlapPolicy
+		expected int
+		skipped  int
+	}{
+		// The first run blocks while two more are triggered
+		{config.OverlapSkip, 1, 2},
+		{config.OverlapQueue, 2, 1},
+		{config.OverlapDelay, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			var counter int
+			var mu sync.Mutex
+			release := make(chan struct{})
+			started := make(chan struct{}, 3)
+
+			// Create a backup function that blocks until released
+			backupFunc := func(ctx context.Context) error {
+				mu.Lock()
+				counter++
+				mu.Unlock()
+				started <- struct{}{}
+				<-release
+				return nil
+			}
+
+			s := New("test", "0 0 31 2 *", tt.policy, backupFunc)
+
+			results := make(chan error, 3)
+			go func() {
+				results <- s.RunNow()
+			}()
+			<-started
+
+			// Trigger two more backups while the first one is running
+			for i := 0; i < 2; i++ {
+				go func() {
+					results <- s.RunNow()
+				}()
+			}
+
+			// Give the overlapping runs a moment to be skipped or to start waiting
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+
+			skipped := 0
+			for i := 0; i < 3; i++ {
+				if err := <-results; errors.Is(err, ErrSkipped) {
+					skipped++
+				} else if err != nil {
+					t.Errorf("Expected backup to succeed, got %v", err)
+				}
+			}
+
+			if counter != tt.expected {
+				t.Errorf("Expected backup function to be called %d times, got %d", tt.expected, counter)
+			}
+
+			if skipped != tt.skipped {
+				t.Errorf("Expected %d skipped runs, got %d", tt.skipped, skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+// Backend is a place backups can be written to and read back from.
+// Keys are slash separated paths such as "backup/mydb-mysql-20240101-000000.sql".
+type Backend interface {
+	// Upload stores everything read from reader under key
+	Upload(ctx context.Context, key string, reader io.Reader, opts UploadOptions) error
+	// List returns all objects whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Download opens the object stored under key. The caller must close the returned reader.
+	Download(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key
+	Delete(ctx context.Context, key string) error
+}
+
+// UploadOptions holds optional attributes stored with an object
+type UploadOptions struct {
+	ContentType     string
+	ContentEncoding string
+	// Metadata holds user defined attributes describing the object. Backends
+	// without object metadata, such as local storage, ignore it, so it is
+	// only informative and the manifest stays authoritative.
+	Metadata map[string]string
+}
+
+// Object describes a stored backup object
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// New creates the storage backend selected by the configuration
+func New(cfg *config.Config) (Backend, error) {
+	switch cfg.StorageType {
+	case config.StorageS3:
+		return NewS3Client(cfg)
+	case config.StorageLocal:
+		return NewLocalBackend(cfg.StoragePath)
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", cfg.StorageType)
+	}
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempFilePrefix marks files that are still being written
+const tempFilePrefix = ".tmp-"
+
+// LocalBackend stores backups in a directory on the local filesystem,
+// e.g. an NFS mount
+type LocalBackend struct {
+	root string
+}
+
+// NewLocalBackend creates a new local filesystem backend rooted at root
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access storage directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("storage path %s is not a directory", root)
+	}
+
+	return &LocalBackend{root: root}, nil
+}
+
+// Upload writes an object to the storage directory. The data is written to a
+// temporary file first, so a failed upload never leaves a partial backup behind.
+// Upload options, including the metadata, are not stored, as plain files have
+// no place for them.
+func (l *LocalBackend) Upload(ctx context.Context, key string, reader io.Reader, opts UploadOptions) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, &contextReader{ctx: ctx, reader: reader}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+
+	return nil
+}
+
+// List lists all objects in the storage directory with the given prefix
+func (l *LocalBackend) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(l.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, path)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, Object{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %w", err)
+	}
+
+	return objects, nil
+}
+
+// Download opens an object for reading. The caller must close the returned reader.
+func (l *LocalBackend) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find backup %s: %w", key, err)
+	}
+
+	return file, nil
+}
+
+// Delete removes an object from the storage directory
+func (l *LocalBackend) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove backup %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// path maps a key to a file below the storage directory
+func (l *LocalBackend) path(key string) (string, error) {
+	clean := filepath.FromSlash(key)
+	if !filepath.IsLocal(clean) {
+		return "", fmt.Errorf("invalid backup key: %s", key)
+	}
+
+	return filepath.Join(l.root, clean), nil
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
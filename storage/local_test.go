@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalBackend(t *testing.T) {
+	ctx := context.Background()
+
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	// Upload a couple of objects
+	keys := []string{
+		"backup/testdb-mysql-20240101-000000.sql",
+		"backup/testdb-mysql-20240102-000000.sql",
+		"other/testdb-mysql-20240101-000000.sql",
+	}
+	for _, key := range keys {
+		if err := backend.Upload(ctx, key, strings.NewReader("dump of "+key), UploadOptions{}); err != nil {
+			t.Fatalf("Failed to upload %s: %v", key, err)
+		}
+	}
+
+	// List only returns objects below the prefix
+	objects, err := backend.List(ctx, "backup/testdb-mysql-")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+
+	if len(objects) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(objects))
+	}
+
+	for _, object := range objects {
+		if object.Size != int64(len("dump of "+object.Key)) {
+			t.Errorf("Expected size of %s to be %d, got %d", object.Key, len("dump of "+object.Key), object.Size)
+		}
+	}
+
+	// Download returns the uploaded content
+	reader, err := backend.Download(ctx, keys[0])
+	if err != nil {
+		t.Fatalf("Failed to download %s: %v", keys[0], err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", keys[0], err)
+	}
+
+	if string(content) != "dump of "+keys[0] {
+		t.Errorf("Expected content 'dump of %s', got '%s'", keys[0], content)
+	}
+
+	// Delete removes the object
+	if err := backend.Delete(ctx, keys[0]); err != nil {
+		t.Fatalf("Failed to delete %s: %v", keys[0], err)
+	}
+
+	objects, err = backend.List(ctx, "backup/")
+	if err != nil {
+		t.Fatalf("Failed to list objects: %v", err)
+	}
+
+	if len(objects) != 1 || objects[0].Key != keys[1] {
+		t.Errorf("Expected only %s to remain, got %v", keys[1], objects)
+	}
+}
+
+func TestLocalBackendFailedUpload(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	backend, err := NewLocalBackend(root)
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	// A failing reader must not leave a partial backup behind
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("partial"))
+		pw.CloseWithError(io.ErrUnexpectedEOF)
+	}()
+
+	if err := backend.Upload(ctx, "backup/testdb-mysql-20240101-000000.sql", pr, UploadOptions{}); err == nil {
+		t.Fatal("Expected error for failed upload, got nil")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "backup"))
+	if err != nil {
+		t.Fatalf("Failed to read storage directory: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("Expected no files after failed upload, got %d", len(entries))
+	}
+}
+
+func TestLocalBackendRejectsEscapingKeys(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local backend: %v", err)
+	}
+
+	if err := backend.Upload(context.Background(), "../outside.sql", strings.NewReader(""), UploadOptions{}); err == nil {
+		t.Error("Expected error for key outside the storage directory, got nil")
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"sort"
+	"os"
 	"strings"
 	"time"
 
@@ -17,8 +17,6 @@ import (
 type S3Client struct {
 	client     *minio.Client
 	bucketName string
-	prefix     string
-	keepLast   int
 }
 
 // NewS3Client creates a new S3 client
@@ -36,7 +34,7 @@ func NewS3Client(cfg *config.Config) (*S3Client, error) {
 
 	// Initialize minio client
 	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Creds:  newS3Credentials(cfg),
 		Secure: cfg.S3UseSSL,
 		Region: cfg.S3Region,
 	})
@@ -58,88 +56,143 @@ func NewS3Client(cfg *config.Config) (*S3Client, error) {
 	return &S3Client{
 		client:     client,
 		bucketName: cfg.S3Bucket,
-		prefix:     cfg.BackupPrefix,
-		keepLast:   cfg.KeepLast,
 	}, nil
 }
 
-// UploadBackup uploads a backup to S3
-func (s *S3Client) UploadBackup(ctx context.Context, reader io.Reader, dbName, dbType string) (string, error) {
-	// Create a timestamp for the backup filename
-	timestamp := time.Now().UTC().Format("20060102-150405")
+// newS3Credentials returns the credentials S3 requests are signed with. The
+// configured keys take precedence. Without them, credentials are looked up
+// like the AWS SDKs do: in the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+// environment variables, the shared credentials file, a web identity token
+// (IAM roles for service accounts), and the ECS or EC2 metadata endpoints.
+func newS3Credentials(cfg *config.Config) *credentials.Credentials {
+	if cfg.S3AccessKey != "" {
+		return credentials.New(&configCredentials{cfg: cfg})
+	}
 
-	// Create the object name with format: prefix/dbname-dbtype-timestamp.sql
-	objName := fmt.Sprintf("%s/%s-%s-%s.sql", s.prefix, dbName, dbType, timestamp)
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{Endpoint: iamEndpoint()},
+	})
+}
 
-	// Upload the backup
-	_, err := s.client.PutObject(ctx, s.bucketName, objName, reader, -1,
-		minio.PutObjectOptions{ContentType: "application/octet-stream"})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload backup: %w", err)
+// iamEndpoint returns the endpoint the IAM provider fetches credentials from
+// when it is overridden like for the AWS SDKs, or an empty string for the
+// default. The provider uses a single endpoint for STS and the EC2 metadata
+// service, so only the override of the source in use applies.
+func iamEndpoint() string {
+	switch {
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "":
+		return os.Getenv("AWS_ENDPOINT_URL_STS")
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		return "" // The container endpoint is given in full
+	default:
+		return os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	}
+}
+
+// configCredentials provides the S3 keys of the configuration. They are read
+// on every request, so keys refreshed from secret files are used right away.
+type configCredentials struct {
+	cfg *config.Config
+}
+
+// Retrieve returns the configured keys
+func (c *configCredentials) Retrieve() (credentials.Value, error) {
+	return credentials.Value{
+		AccessKeyID:     c.cfg.S3AccessKey,
+		SecretAccessKey: c.cfg.S3SecretKey,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// RetrieveWithCredContext returns the configured keys
+func (c *configCredentials) RetrieveWithCredContext(*credentials.CredContext) (credentials.Value, error) {
+	return c.Retrieve()
+}
+
+// IsExpired always reports the keys as expired, so they are read again
+func (c *configCredentials) IsExpired() bool {
+	return true
+}
+
+// Upload uploads an object to S3
+func (s *S3Client) Upload(ctx context.Context, key string, reader io.Reader, opts UploadOptions) error {
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
 	}
 
-	// Clean up old backups
-	if err := s.cleanupOldBackups(ctx, dbName, dbType); err != nil {
-		// Just log the error but don't fail the backup
-		fmt.Printf("Warning: failed to cleanup old backups: %v\n", err)
+	_, err := s.client.PutObject(ctx, s.bucketName, key, reader, -1,
+		minio.PutObjectOptions{
+			ContentType:     contentType,
+			ContentEncoding: opts.ContentEncoding,
+			UserMetadata:    opts.Metadata,
+		})
+	if err != nil {
+		// minio aborts failed multipart uploads with the request context, which
+		// doesn't work once that context is cancelled, so clean up separately
+		if ctx.Err() != nil {
+			s.removeIncompleteUpload(key)
+		}
+		return fmt.Errorf("failed to upload backup: %w", err)
 	}
 
-	return objName, nil
+	return nil
 }
 
-// cleanupOldBackups removes old backups based on the keepLast setting
-func (s *S3Client) cleanupOldBackups(ctx context.Context, dbName, dbType string) error {
-	// List all objects with the prefix
-	prefix := fmt.Sprintf("%s/%s-%s-", s.prefix, dbName, dbType)
+// removeIncompleteUpload aborts a partial multipart upload of key
+func (s *S3Client) removeIncompleteUpload(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
+	if err := s.client.RemoveIncompleteUpload(ctx, s.bucketName, key); err != nil {
+		fmt.Printf("Warning: failed to abort incomplete upload of %s: %v\n", key, err)
+	}
+}
+
+// List lists all objects in the bucket with the given prefix
+func (s *S3Client) List(ctx context.Context, prefix string) ([]Object, error) {
 	objectCh := s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
 		Prefix:    prefix,
 		Recursive: true,
 	})
 
-	// Collect all backup objects
-	var backups []minio.ObjectInfo
+	var objects []Object
 	for object := range objectCh {
 		if object.Err != nil {
-			return fmt.Errorf("error listing objects: %w", object.Err)
+			return nil, fmt.Errorf("error listing objects: %w", object.Err)
 		}
-		backups = append(backups, object)
+		objects = append(objects, Object{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
 	}
 
-	// Sort backups by last modified time (newest first)
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].LastModified.After(backups[j].LastModified)
-	})
+	return objects, nil
+}
 
-	// Keep only the latest N backups
-	if len(backups) > s.keepLast {
-		for i := s.keepLast; i < len(backups); i++ {
-			objName := backups[i].Key
-			err := s.client.RemoveObject(ctx, s.bucketName, objName, minio.RemoveObjectOptions{})
-			if err != nil {
-				return fmt.Errorf("failed to remove old backup %s: %w", objName, err)
-			}
-			fmt.Printf("Removed old backup: %s\n", objName)
-		}
+// Delete removes an object from the bucket
+func (s *S3Client) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucketName, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove backup %s: %w", key, err)
 	}
 
 	return nil
 }
 
-// ListBackups lists all backups in the bucket with the given prefix
-func (s *S3Client) ListBackups(ctx context.Context) ([]string, error) {
-	objectCh := s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{
-		Prefix:    s.prefix,
-		Recursive: true,
-	})
+// Download opens an object for streaming. The caller must close the returned reader.
+func (s *S3Client) Download(ctx context.Context, objName string) (io.ReadCloser, error) {
+	// Make sure the object exists so a missing key fails early instead of on first read
+	if _, err := s.client.StatObject(ctx, s.bucketName, objName, minio.StatObjectOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to find backup %s: %w", objName, err)
+	}
 
-	var backups []string
-	for object := range objectCh {
-		if object.Err != nil {
-			return nil, fmt.Errorf("error listing objects: %w", object.Err)
-		}
-		backups = append(backups, object.Key)
+	object, err := s.client.GetObject(ctx, s.bucketName, objName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup %s: %w", objName, err)
 	}
 
-	return backups, nil
+	return object, nil
 }
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nilsmarti/go-dbdumper/config"
+)
+
+func TestConfigCredentials(t *testing.T) {
+	cfg := &config.Config{S3AccessKey: "accesskey", S3SecretKey: "secretkey"}
+	provider := &configCredentials{cfg: cfg}
+
+	value, err := provider.Retrieve()
+	if err != nil {
+		t.Fatalf("Failed to retrieve credentials: %v", err)
+	}
+	if value.AccessKeyID != "accesskey" || value.SecretAccessKey != "secretkey" {
+		t.Errorf("Unexpected credentials: %s / %s", value.AccessKeyID, value.SecretAccessKey)
+	}
+
+	// Refreshed keys are used for the next request
+	cfg.S3SecretKey = "rotated"
+	if !provider.IsExpired() {
+		t.Error("Expected credentials to be read again")
+	}
+	if value, _ := provider.Retrieve(); value.SecretAccessKey != "rotated" {
+		t.Errorf("Expected rotated secret key, got %s", value.SecretAccessKey)
+	}
+}
+
+// clearAWSEnv unsets the settings of the AWS credential chain, so tests
+// don't pick up credentials of the machine they run on
+func clearAWSEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_SESSION_TOKEN",
+		"AWS_SHARED_CREDENTIALS_FILE", "AWS_CONFIG_FILE", "AWS_PROFILE",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_REGION", "AWS_ENDPOINT_URL_STS",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+}
+
+// roleCredentials is the response of the ECS and EC2 metadata endpoints
+var roleCredentials = map[string]any{
+	"Code":            "Success",
+	"AccessKeyId":     "rolekey",
+	"SecretAccessKey": "rolesecret",
+	"Token":           "roletoken",
+	"Expiration":      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+}
+
+func TestS3CredentialChain(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           config.Config
+		setup         func(t *testing.T)
+		expectedKey   string
+		expectedToken string
+	}{
+		{
+			name: "configured keys",
+			cfg:  config.Config{S3AccessKey: "accesskey", S3SecretKey: "secretkey"},
+			setup: func(t *testing.T) {
+				t.Setenv("AWS_ACCESS_KEY_ID", "envkey")
+				t.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+			},
+			expectedKey: "accesskey",
+		},
+		{
+			name: "environment variables",
+			setup: func(t *testing.T) {
+				t.Setenv("AWS_ACCESS_KEY_ID", "envkey")
+				t.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+			},
+			expectedKey: "envkey",
+		},
+		{
+			name: "shared credentials profile",
+			setup: func(t *testing.T) {
+				file := filepath.Join(t.TempDir(), "credentials")
+				content := "[default]\naws_access_key_id = defaultkey\naws_secret_access_key = defaultsecret\n\n" +
+					"[backup]\naws_access_key_id = profilekey\naws_secret_access_key = profilesecret\n"
+				if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+					t.Fatalf("Failed to write credentials file: %v", err)
+				}
+				t.Setenv("AWS_SHARED_CREDENTIALS_FILE", file)
+				t.Setenv("AWS_PROFILE", "backup")
+			},
+			expectedKey: "profilekey",
+		},
+		{
+			name: "web identity",
+			setup: func(t *testing.T) {
+				sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("WebIdentityToken") != "jwt" {
+						http.Error(w, "unexpected request", http.StatusBadRequest)
+						return
+					}
+					w.Header().Set("Content-Type", "text/xml")
+					w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>stskey</AccessKeyId>
+      <SecretAccessKey>stssecret</SecretAccessKey>
+      <SessionToken>ststoken</SessionToken>
+      <Expiration>` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+				}))
+				t.Cleanup(sts.Close)
+
+				tokenFile := filepath.Join(t.TempDir(), "token")
+				if err := os.WriteFile(tokenFile, []byte("jwt"), 0o600); err != nil {
+					t.Fatalf("Failed to write token file: %v", err)
+				}
+				t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+				t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/backup")
+				t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+			},
+			expectedKey:   "stskey",
+			expectedToken: "ststoken",
+		},
+		{
+			name: "container metadata",
+			setup: func(t *testing.T) {
+				ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != "/v2/credentials/task" {
+						http.NotFound(w, r)
+						return
+					}
+					json.NewEncoder(w).Encode(roleCredentials)
+				}))
+				t.Cleanup(ecs.Close)
+
+				t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", ecs.URL+"/v2/credentials/task")
+			},
+			expectedKey:   "rolekey",
+			expectedToken: "roletoken",
+		},
+		{
+			name: "instance metadata",
+			setup: func(t *testing.T) {
+				imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					switch {
+					case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+						w.Write([]byte("imdstoken"))
+					case r.Header.Get("X-aws-ec2-metadata-token") != "imdstoken":
+						http.Error(w, "missing token", http.StatusUnauthorized)
+					case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+						w.Write([]byte("backup-role"))
+					case r.URL.Path == "/latest/meta-data/iam/security-credentials/backup-role":
+						json.NewEncoder(w).Encode(roleCredentials)
+					default:
+						http.NotFound(w, r)
+					}
+				}))
+				t.Cleanup(imds.Close)
+
+				t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+			},
+			expectedKey:   "rolekey",
+			expectedToken: "roletoken",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearAWSEnv(t)
+			tt.setup(t)
+
+			value, err := newS3Credentials(&tt.cfg).Get()
+			if err != nil {
+				t.Fatalf("Failed to get credentials: %v", err)
+			}
+
+			if value.AccessKeyID != tt.expectedKey {
+				t.Errorf("Expected access key %s, got %s", tt.expectedKey, value.AccessKeyID)
+			}
+			if value.SessionToken != tt.expectedToken {
+				t.Errorf("Expected session token %q, got %q", tt.expectedToken, value.SessionToken)
+			}
+		})
+	}
+}